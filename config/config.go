@@ -9,14 +9,26 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Cookie   Cookie
-	Session  Session
-	Logger   Logger
-	Metrics  Metrics
-	MongoDB  MongoDBConfig
-	Redis    RedisConfig
-	Services Services
+	Server     ServerConfig
+	Cookie     Cookie
+	Session    Session
+	Logger     Logger
+	Metrics    Metrics
+	Storage    StorageConfig
+	MongoDB    MongoDBConfig
+	Redis      RedisConfig
+	Services   Services
+	Admin      AdminConfig
+	Audit      AuditConfig
+	Archive    ArchiveConfig
+	Retention  RetentionConfig
+	Encryption EncryptionConfig
+	Rendering  RenderingConfig
+	// FakeRenderer configures the fake-renderer command, never the service.
+	FakeRenderer FakeRendererConfig
+	// Projects overrides DefaultProject for the projects it lists.
+	DefaultProject ProjectConfig
+	Projects       []ProjectConfig
 }
 
 type ServerConfig struct {
@@ -42,9 +54,20 @@ type Logger struct {
 	Level             string
 }
 
+// StorageConfig selects where sessions, the audit log and access keys live:
+// "mongo", with access keys in Redis, "bolt", an embedded database file at
+// BoltPath for single-node deployments, or "memory", lost on exit, for dev
+// mode and tests.
+type StorageConfig struct {
+	Backend  string
+	BoltPath string
+}
+
 type MongoDBConfig struct {
 	MongoURI string
 	Database string
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool
 }
 
 type Cookie struct {
@@ -79,7 +102,174 @@ type RedisConfig struct {
 }
 
 type Services struct {
-	OtididaeURL string
+	OtididaeURL       string
+	OtididaeDeleteURL string
+	Otididae          OtididaeConfig
+}
+
+// OtididaeConfig spreads renders across several Otididae nodes; without
+// Endpoints, OtididaeURL and OtididaeDeleteURL are the only one. Balancing is
+// "round-robin", weighted by Weight, or "least-inflight". MaxConns limits the
+// connections to each endpoint. An endpoint failing FailureThreshold requests
+// in a row is skipped for OpenDuration, then tried with a single request.
+// Durations are in seconds.
+type OtididaeConfig struct {
+	Endpoints        []OtididaeEndpoint
+	Balancing        string
+	RequestTimeout   time.Duration
+	MaxConns         int
+	HealthInterval   time.Duration
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// OtididaeEndpoint is one Otididae node. Nodes without HealthURL are only
+// taken out by their circuit breaker.
+type OtididaeEndpoint struct {
+	RenderURL string
+	DeleteURL string
+	HealthURL string
+	Weight    int
+}
+
+// AdminConfig lists the tokens accepted by the admin API, each named after
+// the operator or system holding it. ReadTokens only read sessions through
+// the session API, which admin Tokens may read as well.
+type AdminConfig struct {
+	Tokens     []AdminToken
+	ReadTokens []AdminToken
+}
+
+type AdminToken struct {
+	Name  string
+	Token string
+}
+
+// AuditConfig keys the hash chain of the audit log. With a ChainKey, records
+// are chained with HMAC-SHA256 and cannot be rewritten without the key;
+// without one, the chain is plain SHA-256 and only catches accidental damage.
+type AuditConfig struct {
+	ChainKey string
+}
+
+// ArchiveConfig tells restore where to put videos found in a bundle and the
+// public URL they are served from.
+type ArchiveConfig struct {
+	VideoDir     string
+	VideoBaseURL string
+}
+
+// RetentionConfig schedules the sweeper that expires sessions past the
+// retention of their project. SweepInterval is in minutes.
+type RetentionConfig struct {
+	Enabled       bool
+	SweepInterval time.Duration
+}
+
+// EncryptionConfig enables envelope encryption of session payloads with the
+// master keys of KeyFile, managed with the encryption command.
+type EncryptionConfig struct {
+	Enabled bool
+	KeyFile string
+}
+
+// RenderingConfig schedules render jobs. Workers dispatch them to the
+// renderers, picking among the queued Classes in proportion to their Weight so
+// that low classes are slowed down rather than starved. Recordings wait in
+// SpoolDir, the system temporary directory when empty. Renderers post their
+// results with CallbackToken, which is accepted by no other endpoint.
+type RenderingConfig struct {
+	Workers       int
+	SpoolDir      string
+	Classes       []RenderClass
+	DefaultClass  string
+	CallbackToken string
+}
+
+// RenderClass is a render priority class, such as "interactive" or "bulk".
+type RenderClass struct {
+	Name   string
+	Weight int
+}
+
+// FakeRendererConfig drives the fake-renderer command, a local stand-in for
+// Otididae. Each render takes a random latency between MinLatency and
+// MaxLatency milliseconds and fails with probability FailureRate. Recordings
+// are stored in StorageDir and served under BaseURL, and the result is posted
+// to CallbackURL with CallbackToken, the Rendering.CallbackToken of the service.
+type FakeRendererConfig struct {
+	Port          string
+	StorageDir    string
+	BaseURL       string
+	MinLatency    time.Duration
+	MaxLatency    time.Duration
+	FailureRate   float64
+	CallbackURL   string
+	CallbackToken string
+}
+
+// ProjectConfig holds the settings of the project identified by an access key.
+type ProjectConfig struct {
+	Key     string
+	Privacy PrivacyConfig
+	// RetentionDays after which sessions expire; zero keeps them forever.
+	RetentionDays int
+	Masking       []MaskingRule
+	Renderer      RendererConfig
+	// RenderPriority is the Rendering class of the renders of the project,
+	// Rendering.DefaultClass when empty. MaxConcurrentRenders caps how many
+	// of them are dispatched at once; zero leaves them uncapped.
+	RenderPriority       string
+	MaxConcurrentRenders int
+}
+
+// RendererConfig selects how the videos of a project are rendered: "http" by
+// Otididae at Services.OtididaeURL, "exec" by running Command on the spooled
+// recording, with its timelines and masks written to SpoolDir, or "noop" to
+// render nothing. The exec renderer writes
+// videos to OutputDir, served from VideoBaseURL, and stops Command after
+// Timeout seconds.
+type RendererConfig struct {
+	Backend      string
+	Command      []string
+	SpoolDir     string
+	OutputDir    string
+	VideoBaseURL string
+	Timeout      time.Duration
+}
+
+// MaskingRule hides the gestures of sensitive activities, matched by exact
+// Activity name or by the Pattern regular expression. Mode is "drop" to remove
+// the gestures, "blur" to move every coordinate to the screen centre or
+// "strip-text" to remove text input actions.
+type MaskingRule struct {
+	Activity string
+	Pattern  string
+	Mode     string
+}
+
+// PrivacyConfig controls what device data is kept at ingest. With
+// PseudonymizeInstallID the install ID is replaced by its HMAC-SHA256 keyed
+// with InstallIDSecret. Drop and Coarsen name device fields by their JSON
+// name: totalRAM, totalStorage or batteryLevel.
+type PrivacyConfig struct {
+	PseudonymizeInstallID bool
+	InstallIDSecret       string
+	Drop                  []string
+	Coarsen               []string
+}
+
+// Project returns the settings of the project with the given access key,
+// falling back to DefaultProject.
+func (c *Config) Project(key string) ProjectConfig {
+	for _, project := range c.Projects {
+		if project.Key == key {
+			return project
+		}
+	}
+	project := c.DefaultProject
+	project.Key = key
+	return project
 }
 
 func LoadConfig(filename string) (*viper.Viper, error) {
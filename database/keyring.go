@@ -0,0 +1,19 @@
+package database
+
+import (
+	"errors"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/envelope"
+)
+
+// LoadKeyring loads the master keys session payloads are encrypted with, or
+// returns nil when encryption is disabled.
+func LoadKeyring(c *config.Config) (*envelope.Keyring, error) {
+	if !c.Encryption.Enabled {
+		return nil, nil
+	}
+	if c.Encryption.KeyFile == "" {
+		return nil, errors.New("encryption is enabled without a keyfile")
+	}
+	return envelope.LoadKeyring(c.Encryption.KeyFile)
+}
@@ -0,0 +1,181 @@
+// Package migrations versions the Mongo schema: indexes and transformations
+// of existing documents. Applied versions are recorded in the migrations
+// collection.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName   = "migrations"
+	migrationTimeout = 30 * time.Minute
+)
+
+// ErrIrreversible is returned when rolling back a migration without Down.
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// Migration is one schema version. Down is nil for migrations that cannot be
+// undone, such as backfills.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// AppliedMigration is the record of a migration in the migrations collection.
+type AppliedMigration struct {
+	Version     int       `json:"version"`
+	Description string    `json:"description"`
+	AppliedAt   time.Time `json:"appliedAt"`
+}
+
+// MigrationStatus tells whether a known migration was applied.
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"appliedAt"`
+}
+
+// Migrator applies and rolls back the registered migrations in version order.
+type Migrator struct {
+	database   *mongo.Database
+	migrations []Migration
+}
+
+func NewMigrator(database *mongo.Database) *Migrator {
+	return &Migrator{database: database, migrations: registry}
+}
+
+// Up applies every pending migration up to target, or all of them when target
+// is zero, and returns the versions applied.
+func (m *Migrator) Up(target int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]int, 0)
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := migration.Up(ctx, m.database); err != nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		record := AppliedMigration{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now().UTC()}
+		if _, err := m.database.Collection(collectionName).InsertOne(ctx, record); err != nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and returns
+// the versions rolled back.
+func (m *Migrator) Down(steps int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]int, 0)
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, ErrIrreversible)
+		}
+		if err := migration.Down(ctx, m.database); err != nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		if _, err := m.database.Collection(collectionName).DeleteOne(ctx, bson.M{"version": migration.Version}); err != nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// Status lists every registered migration with when it was applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of registered migrations not applied yet.
+func (m *Migrator) Pending() (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	collection := m.database.Collection(collectionName)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []AppliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]AppliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
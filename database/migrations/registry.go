@@ -0,0 +1,138 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"nymphicus-service/enum"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// registry lists the migrations in version order. Never edit an applied
+// migration; add a new one.
+var registry = []Migration{
+	{
+		Version:     1,
+		Description: "index sessions by id, project, status, creation date and install ID",
+		Up:          createIndexes("sessions", sessionIndexes...),
+		Down:        dropIndexes("sessions", sessionIndexes...),
+	},
+	{
+		Version:     2,
+		Description: "index the audit log by sequence and target",
+		Up:          createIndexes("audit", auditIndexes...),
+		Down:        dropIndexes("audit", auditIndexes...),
+	},
+	{
+		Version:     3,
+		Description: "normalize session status values",
+		Up:          normalizeStatuses,
+	},
+	{
+		Version:     4,
+		Description: "backfill signal count and legal hold of legacy sessions",
+		Up:          backfillSessionFields,
+	},
+	{
+		Version:     5,
+		Description: "index the chunks of oversized sessions",
+		Up:          createIndexes("session_chunks", chunkIndexes...),
+		Down:        dropIndexes("session_chunks", chunkIndexes...),
+	},
+}
+
+var sessionIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "key", Value: 1}, {Key: "createdat", Value: -1}}},
+	{Keys: bson.D{{Key: "key", Value: 1}, {Key: "status", Value: 1}}},
+	{Keys: bson.D{{Key: "key", Value: 1}, {Key: "signalcount", Value: -1}, {Key: "createdat", Value: -1}}},
+	{Keys: bson.D{{Key: "createdat", Value: 1}, {Key: "id", Value: 1}}},
+	{Keys: bson.D{{Key: "device.installid", Value: 1}}},
+}
+
+// The unique sequence index is what makes concurrent audit appends retry
+// instead of forking the hash chain. The audit repository creates it too, so
+// that appends are safe before this migration runs.
+var auditIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "sequence", Value: 1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "target", Value: 1}, {Key: "sequence", Value: 1}}},
+}
+
+var chunkIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "sessionid", Value: 1}, {Key: "index", Value: 1}}, Options: options.Index().SetUnique(true)},
+}
+
+var wordBoundary = regexp.MustCompile(`([a-z])([A-Z])`)
+
+func createIndexes(collection string, indexes ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+func dropIndexes(collection string, indexes ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, index := range indexes {
+			if _, err := db.Collection(collection).Indexes().DropOne(ctx, indexName(index.Keys.(bson.D))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// indexName returns the name Mongo gives an index by default, such as
+// "key_1_createdat_-1".
+func indexName(keys bson.D) string {
+	name := ""
+	for i, key := range keys {
+		if i > 0 {
+			name += "_"
+		}
+		name += fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return name
+}
+
+// normalizeStatuses rewrites statuses written with another case or with
+// separators, such as "error" or "IN_PROGRESS", to the enum.SessionStatus names.
+func normalizeStatuses(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("sessions")
+	for _, status := range []enum.SessionStatus{enum.InProgress, enum.Complete, enum.Error, enum.Expired} {
+		name := status.String()
+		// "InProgress" also matches "in_progress" and "in-progress".
+		pattern := "^" + wordBoundary.ReplaceAllString(name, "$1[_ -]?$2") + "$"
+		filter := bson.M{"status": bson.M{
+			"$regex": pattern, "$options": "i",
+			"$ne": name,
+		}}
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": name}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillSessionFields sets the fields sessions stored before frustration
+// signals and legal holds existed are queried and sorted by.
+func backfillSessionFields(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("sessions")
+	backfills := []struct {
+		field string
+		value interface{}
+	}{
+		{"signalcount", 0},
+		{"legalhold", false},
+	}
+	for _, backfill := range backfills {
+		filter := bson.M{backfill.field: bson.M{"$exists": false}}
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{backfill.field: backfill.value}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
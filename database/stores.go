@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/database/migrations"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/repository"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	StorageMongo  = "mongo"
+	StorageBolt   = "bolt"
+	StorageMemory = "memory"
+)
+
+// Stores are the repositories of the configured storage backend.
+type Stores struct {
+	Sessions   repository.SessionRepository
+	Audit      repository.AuditRepository
+	AccessKeys repository.AccessKeyRepository
+	close      func() error
+}
+
+// Close releases the connections or files of the backend.
+func (s *Stores) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// OpenStores connects to the storage backend of Storage.Backend, Mongo by
+// default, and builds the repositories on top of it.
+func OpenStores(c *config.Config, logger logger.Logger) (*Stores, error) {
+	keyring, err := LoadKeyring(c)
+	if err != nil {
+		return nil, err
+	}
+
+	chainKey := []byte(c.Audit.ChainKey)
+	if len(chainKey) == 0 {
+		logger.Warnf("Audit.ChainKey is not set, the audit chain is not keyed")
+	}
+
+	switch c.Storage.Backend {
+	case "", StorageMongo:
+		redisClient, err := NewRedisClient(c)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Redis connected")
+
+		mongoClient, err := ConnectionDatabase(c, logger)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkMigrations(c, logger, migrations.NewMigrator(mongoClient)); err != nil {
+			return nil, err
+		}
+
+		return &Stores{
+			Sessions:   repository.NewSessionRepository(mongoClient, keyring),
+			Audit:      repository.NewAuditRepository(mongoClient, chainKey),
+			AccessKeys: repository.NewAccessKeyRepository(redisClient),
+			close:      redisClient.Close,
+		}, nil
+	case StorageBolt:
+		db, err := bolt.Open(c.Storage.BoltPath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", c.Storage.BoltPath, err)
+		}
+		logger.Infof("Opened embedded store %s", c.Storage.BoltPath)
+
+		stores := &Stores{close: db.Close}
+		if stores.Sessions, err = repository.NewBoltSessionRepository(db, keyring); err != nil {
+			return nil, err
+		}
+		if stores.Audit, err = repository.NewBoltAuditRepository(db, chainKey); err != nil {
+			return nil, err
+		}
+		if stores.AccessKeys, err = repository.NewBoltAccessKeyRepository(db); err != nil {
+			return nil, err
+		}
+		return stores, nil
+	case StorageMemory:
+		logger.Warnf("Using in-memory storage, nothing is persisted")
+		return &Stores{
+			Sessions:   repository.NewMemorySessionRepository(keyring),
+			Audit:      repository.NewMemoryAuditRepository(chainKey),
+			AccessKeys: repository.NewMemoryAccessKeyRepository(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", c.Storage.Backend)
+	}
+}
+
+// checkMigrations applies the pending Mongo migrations when MongoDB.AutoMigrate
+// is set and warns about them otherwise.
+func checkMigrations(c *config.Config, logger logger.Logger, migrator *migrations.Migrator) error {
+	if c.MongoDB.AutoMigrate {
+		applied, err := migrator.Up(0)
+		if err != nil {
+			return fmt.Errorf("migrations: %w", err)
+		}
+		logger.Infof("Applied %d migrations", len(applied))
+		return nil
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		logger.Warnf("Migrations: %s", err)
+	} else if pending > 0 {
+		logger.Warnf("%d migrations are pending, run: migrate up", pending)
+	}
+	return nil
+}
@@ -6,8 +6,9 @@ const (
 	InProgress SessionStatus = iota
 	Complete
 	Error
+	Expired
 )
 
 func (os SessionStatus) String() string {
-	return [...]string{"InProgress", "Complete", "Error"}[os]
+	return [...]string{"InProgress", "Complete", "Error", "Expired"}[os]
 }
@@ -0,0 +1,27 @@
+package enum
+
+type AuditAction int
+
+const (
+	SubjectExport AuditAction = iota
+	SubjectDelete
+	LegalHoldSet
+	LegalHoldRelease
+	RetentionSweep
+	SessionsExport
+	SessionsArchive
+	SessionsRestore
+	SessionDelete
+	AccessKeyCreate
+	AccessKeyRevoke
+	EncryptionRotate
+	RenderRequest
+)
+
+func (a AuditAction) String() string {
+	return [...]string{
+		"subject.export", "subject.delete", "legal-hold.set", "legal-hold.release", "retention.sweep",
+		"sessions.export", "sessions.archive", "sessions.restore", "session.delete",
+		"access-key.create", "access-key.revoke", "encryption.rotate", "render.request",
+	}[a]
+}
@@ -0,0 +1,13 @@
+package enum
+
+type FrustrationSignal int
+
+const (
+	RageTap FrustrationSignal = iota
+	ActivityThrashing
+	IdleBurst
+)
+
+func (f FrustrationSignal) String() string {
+	return [...]string{"rage-tap", "activity-thrashing", "idle-burst"}[f]
+}
@@ -0,0 +1,18 @@
+package enum
+
+type GestureType int
+
+const (
+	Unknown GestureType = iota
+	Tap
+	DoubleTap
+	LongPress
+	Swipe
+	Fling
+	Pinch
+	Scroll
+)
+
+func (g GestureType) String() string {
+	return [...]string{"unknown", "tap", "double-tap", "long-press", "swipe", "fling", "pinch", "scroll"}[g]
+}
@@ -9,6 +9,7 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.18.2
 	github.com/valyala/fasthttp v1.54.0
+	go.etcd.io/bbolt v1.3.10
 	go.mongodb.org/mongo-driver v1.15.0
 )
 
@@ -6,6 +6,7 @@ import (
 	"nymphicus-service/database"
 	"nymphicus-service/pkg/logger"
 	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src/commands"
 	"nymphicus-service/src/server"
 	"os"
 )
@@ -28,18 +29,23 @@ func main() {
 	appLogger.InitLogger()
 	appLogger.Infof("AppVersion: %s, LogLevel: %s, Mode: %s, SSL: %v", cfg.Server.AppVersion, cfg.Logger.Level, cfg.Server.Mode, cfg.Server.SSL)
 
-	redisClient, err := database.NewRedisClient(cfg)
-	if err != nil {
-		appLogger.Fatalf("Redis init: %s", err)
+	if len(os.Args) > 1 {
+		if err := commands.Run(cfg, appLogger, os.Args[1:]); err != nil {
+			appLogger.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
 	}
-	appLogger.Infof("Redis connected")
 
-	mongoClient, err := database.ConnectionDatabase(cfg, appLogger)
+	stores, err := database.OpenStores(cfg, appLogger)
 	if err != nil {
-		log.Fatal(err)
+		appLogger.Fatalf("Storage init: %s", err)
 	}
+	defer stores.Close()
 
-	s := server.NewServer(cfg, appLogger, mongoClient, redisClient)
+	s, err := server.NewServer(cfg, appLogger, stores)
+	if err != nil {
+		appLogger.Fatalf("Server init: %s", err)
+	}
 	if err = s.Run(); err != nil {
 		log.Fatal(err)
 	}
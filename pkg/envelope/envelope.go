@@ -0,0 +1,218 @@
+// Package envelope implements envelope encryption: payloads are sealed with a
+// per-record data key, and data keys are wrapped by a master key from a
+// keyfile. Rotating the master key only re-wraps data keys.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const keySize = 32 // AES-256
+
+// WrappedKey is a data key encrypted with the master key KeyID.
+type WrappedKey struct {
+	KeyID string
+	Key   []byte
+}
+
+// keyfile is the JSON layout of a keyfile. Keys are base64 encoded.
+type keyfile struct {
+	Active   string            `json:"active"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"indexKey"`
+}
+
+// Keyring holds the master keys of a keyfile. Data keys are wrapped with the
+// Active one; the others only unwrap keys that were not rotated yet.
+type Keyring struct {
+	active   string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// LoadKeyring reads the keyfile at path.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyfile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyfile: %v", err)
+	}
+
+	keyring := &Keyring{active: file.Active, keys: make(map[string][]byte, len(file.Keys))}
+	for id, encoded := range file.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %q: %v", id, err)
+		}
+		keyring.keys[id] = key
+	}
+	if _, ok := keyring.keys[file.Active]; !ok {
+		return nil, fmt.Errorf("active master key %q is not in the keyfile", file.Active)
+	}
+	if keyring.indexKey, err = decodeKey(file.IndexKey); err != nil {
+		return nil, fmt.Errorf("invalid index key: %v", err)
+	}
+	return keyring, nil
+}
+
+// AddKey generates a master key named id in the keyfile at path and makes it
+// the active one, creating the keyfile when it does not exist.
+func AddKey(path string, id string) error {
+	if id == "" {
+		return errors.New("key id cannot be empty")
+	}
+
+	file := keyfile{Keys: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("invalid keyfile: %v", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		indexKey, err := randomBytes(keySize)
+		if err != nil {
+			return err
+		}
+		file.IndexKey = base64.StdEncoding.EncodeToString(indexKey)
+	default:
+		return err
+	}
+	if _, ok := file.Keys[id]; ok {
+		return fmt.Errorf("master key %q already exists", id)
+	}
+
+	key, err := randomBytes(keySize)
+	if err != nil {
+		return err
+	}
+	file.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	file.Active = id
+
+	data, err = json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// ActiveKeyID returns the ID of the master key new data keys are wrapped with.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// NewDataKey returns a random data key and its wrapped form.
+func (k *Keyring) NewDataKey() ([]byte, WrappedKey, error) {
+	dataKey, err := randomBytes(keySize)
+	if err != nil {
+		return nil, WrappedKey{}, err
+	}
+	wrapped, err := Seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return nil, WrappedKey{}, err
+	}
+	return dataKey, WrappedKey{KeyID: k.active, Key: wrapped}, nil
+}
+
+// Unwrap decrypts a data key.
+func (k *Keyring) Unwrap(wrapped WrappedKey) ([]byte, error) {
+	masterKey, ok := k.keys[wrapped.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", wrapped.KeyID)
+	}
+	return Open(masterKey, wrapped.Key, []byte(wrapped.KeyID))
+}
+
+// Rewrap wraps a data key again with the active master key. It reports false
+// when the key already was.
+func (k *Keyring) Rewrap(wrapped WrappedKey) (WrappedKey, bool, error) {
+	if wrapped.KeyID == k.active {
+		return wrapped, false, nil
+	}
+	dataKey, err := k.Unwrap(wrapped)
+	if err != nil {
+		return wrapped, false, err
+	}
+	rewrapped, err := Seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return wrapped, false, err
+	}
+	return WrappedKey{KeyID: k.active, Key: rewrapped}, true, nil
+}
+
+// BlindIndex returns a keyed hash of value that can be stored and queried in
+// place of the value. It does not depend on the master keys, so it survives
+// rotation.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal encrypts plaintext with AES-GCM, binding it to additionalData. The
+// nonce is prepended to the result.
+func Seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts the output of Seal.
+func Open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
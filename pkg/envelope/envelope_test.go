@@ -0,0 +1,92 @@
+package envelope
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func testKeyring(t *testing.T, ids ...string) (*Keyring, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keyfile.json")
+	for _, id := range ids {
+		if err := AddKey(path, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring, path
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := randomBytes(keySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(key, []byte("gestures"), []byte("session-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("gestures")) {
+		t.Fatal("sealed data contains the plaintext")
+	}
+
+	opened, err := Open(key, sealed, []byte("session-1"))
+	if err != nil || string(opened) != "gestures" {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+	if _, err := Open(key, sealed, []byte("session-2")); err == nil {
+		t.Error("Open accepted another additional data")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := Open(key, sealed, []byte("session-1")); err == nil {
+		t.Error("Open accepted tampered data")
+	}
+	if _, err := Open(key, []byte("short"), nil); err == nil {
+		t.Error("Open accepted data shorter than a nonce")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	keyring, path := testKeyring(t, "k1")
+	dataKey, wrapped, err := keyring.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := keyring.BlindIndex("install")
+
+	if err := AddKey(path, "k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddKey(path, "k2"); err == nil {
+		t.Error("AddKey accepted an existing id")
+	}
+	rotated, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ActiveKeyID() != "k2" {
+		t.Fatalf("active key = %q, want k2", rotated.ActiveKeyID())
+	}
+	if rotated.BlindIndex("install") != index {
+		t.Error("blind index changed with rotation")
+	}
+
+	rewrapped, changed, err := rotated.Rewrap(wrapped)
+	if err != nil || !changed || rewrapped.KeyID != "k2" {
+		t.Fatalf("Rewrap = %+v, %v, %v", rewrapped, changed, err)
+	}
+	unwrapped, err := rotated.Unwrap(rewrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("Unwrap after rewrap = %x, %v", unwrapped, err)
+	}
+	if _, changed, _ := rotated.Rewrap(rewrapped); changed {
+		t.Error("Rewrap changed a key wrapped with the active master key")
+	}
+	if _, err := keyring.Unwrap(rewrapped); err == nil {
+		t.Error("a keyring without k2 unwrapped a key wrapped with it")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
 	"regexp"
 	"strings"
@@ -130,9 +131,15 @@ func NewInternalServerError(causes interface{}) RestErr {
 }
 
 func ParseErrors(err error) RestErr {
+	// An error that already carries its status keeps it, whatever it says.
+	if restErr, ok := err.(RestErr); ok {
+		return restErr
+	}
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return NewRestError(http.StatusNotFound, NotFound.Error(), err)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NewRestError(http.StatusNotFound, NotFound.Error(), err)
 	case errors.Is(err, context.DeadlineExceeded):
 		return NewRestError(http.StatusRequestTimeout, RequestTimeoutError.Error(), err)
 	case strings.Contains(err.Error(), "SQLSTATE"):
@@ -150,9 +157,6 @@ func ParseErrors(err error) RestErr {
 	case strings.Contains(strings.ToLower(err.Error()), "bcrypt"):
 		return NewRestError(http.StatusBadRequest, BadRequest.Error(), err)
 	default:
-		if restErr, ok := err.(RestErr); ok {
-			return restErr
-		}
 		return NewInternalServerError(err)
 	}
 }
@@ -0,0 +1,26 @@
+package httpErrors
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{NewBadRequestError("invalid resume token"), http.StatusBadRequest},
+		{NewUnauthorizedError("invalid admin token"), http.StatusUnauthorized},
+		{errors.New("token is expired"), http.StatusUnauthorized},
+		{mongo.ErrNoDocuments, http.StatusNotFound},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	} {
+		if got := ParseErrors(test.err).Status(); got != test.want {
+			t.Errorf("ParseErrors(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
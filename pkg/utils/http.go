@@ -36,6 +36,13 @@ func HandleRequestError(ctx *fasthttp.RequestCtx, err error, logger logger.Logge
 	_ = json.NewEncoder(ctx.Response.BodyWriter()).Encode(body)
 }
 
+// RespondWithJSON encodes body as the JSON response with the given status code.
+func RespondWithJSON(ctx *fasthttp.RequestCtx, status int, body interface{}) {
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	_ = json.NewEncoder(ctx.Response.BodyWriter()).Encode(body)
+}
+
 func GetConfigPath(configPath string) string {
 	if configPath == "production" {
 		return "./config/config-production"
@@ -0,0 +1,92 @@
+package src
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ActionDown        = "DOWN"
+	ActionMove        = "MOVE"
+	ActionUp          = "UP"
+	ActionPointerDown = "POINTER_DOWN"
+	ActionPointerUp   = "POINTER_UP"
+	ActionCancel      = "CANCEL"
+	ActionTextInput   = "TEXT_INPUT"
+)
+
+// Point is a screen coordinate in pixels.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Distance returns the euclidean distance between two points.
+func (p Point) Distance(o Point) float64 {
+	return math.Hypot(o.X-p.X, o.Y-p.Y)
+}
+
+// Kind returns the action name normalized to upper case without the
+// Android "ACTION_" prefix, so "ACTION_DOWN", "down" and "Down" all match ActionDown.
+func (a Action) Kind() string {
+	kind := strings.ToUpper(strings.TrimSpace(a.Action))
+	return strings.TrimPrefix(kind, "ACTION_")
+}
+
+// IsTextInput reports whether the action carries typed text rather than a
+// touch: TEXT_INPUT, TEXT or any KEY_ event.
+func (a Action) IsTextInput() bool {
+	kind := a.Kind()
+	return kind == ActionTextInput || kind == "TEXT" || strings.HasPrefix(kind, "KEY_")
+}
+
+// Timestamp parses TargetTime into milliseconds. Integer values are taken as
+// milliseconds, fractional values as seconds and anything else as RFC 3339.
+func (a Action) Timestamp() (int64, error) {
+	value := strings.TrimSpace(a.TargetTime)
+	if value == "" {
+		return 0, fmt.Errorf("targetTime is empty")
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return int64(seconds * 1000), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid targetTime %q", a.TargetTime)
+	}
+	return t.UnixMilli(), nil
+}
+
+// Points parses Coordinates into one point per pointer. Pointers are separated
+// by ";" or "|" and each pointer is written as "x,y", optionally wrapped in brackets.
+func (a Action) Points() ([]Point, error) {
+	value := strings.TrimSpace(a.Coordinates)
+	if value == "" {
+		return nil, fmt.Errorf("coordinates are empty")
+	}
+
+	var points []Point
+	for _, raw := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '|' }) {
+		raw = strings.Trim(strings.TrimSpace(raw), "()[]{}")
+		parts := strings.Split(raw, ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid coordinates %q", a.Coordinates)
+		}
+		x, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinates %q", a.Coordinates)
+		}
+		y, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinates %q", a.Coordinates)
+		}
+		points = append(points, Point{X: x, Y: y})
+	}
+	return points, nil
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/repository"
+	service "nymphicus-service/src/services"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Archive packages sessions of a project into a tar.gz bundle, either the
+// ones listed with -ids or every session created within -from and -to.
+func Archive(cfg *config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("archive", flag.ContinueOnError)
+	key := flags.String("key", "", "project access key (required)")
+	ids := flags.String("ids", "", "comma separated session IDs")
+	out := flags.String("out", "sessions.tar.gz", "bundle file to write")
+	from := flags.String("from", "", "only sessions created at or after this date")
+	to := flags.String("to", "", "only sessions created before this date")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *key == "" {
+		return errors.New("-key is required")
+	}
+
+	filter := repository.SessionFilter{Key: *key}
+	var err error
+	if filter.From, err = parseDate("from", *from); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate("to", *to); err != nil {
+		return err
+	}
+	var sessionIDs []string
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archiver := service.NewSessionArchiver(cfg, store.Sessions)
+	count, err := archiver.Archive(file, filter, sessionIDs)
+	if err != nil {
+		return err
+	}
+	details := map[string]string{"key": *key, "sessions": strconv.Itoa(count)}
+	if len(sessionIDs) > 0 {
+		details["ids"] = strings.Join(sessionIDs, ",")
+	}
+	if err := store.auditLog.Record(cliActor(), enum.SessionsArchive, "sessions", details); err != nil {
+		return err
+	}
+	logger.Infof("Archived %d sessions to %s", count, *out)
+	return nil
+}
+
+// Restore imports a bundle written by Archive into the project of -key,
+// printing how the bundled session IDs were remapped.
+func Restore(cfg *config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	key := flags.String("key", "", "access key of the target project (required)")
+	in := flags.String("in", "sessions.tar.gz", "bundle file to read")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *key == "" {
+		return errors.New("-key is required")
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archiver := service.NewSessionArchiver(cfg, store.Sessions)
+	restored, err := archiver.Restore(file, *key)
+	details := map[string]string{"key": *key, "restored": strconv.Itoa(len(restored))}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	if auditErr := store.auditLog.Record(cliActor(), enum.SessionsRestore, "sessions", details); auditErr != nil && err == nil {
+		err = auditErr
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(restored); encodeErr != nil && err == nil {
+		err = encodeErr
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof("Restored %d sessions from %s", len(restored), *in)
+	return nil
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/logger"
+	service "nymphicus-service/src/services"
+	"os"
+)
+
+// Audit inspects the audit log:
+//
+//	audit verify [sequence:hash]  checks the hash chain and fails at the first
+//	                              broken record, or when the log no longer
+//	                              holds the anchored record
+func Audit(cfg *config.Config, logger logger.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("expected verify")
+	}
+	var anchor service.AuditAnchor
+	if len(args) > 1 {
+		parsed, err := service.ParseAuditAnchor(args[1])
+		if err != nil {
+			return err
+		}
+		anchor = parsed
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	verification, err := store.auditLog.Verify(anchor)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(verification); err != nil {
+		return err
+	}
+	if !verification.Valid {
+		return fmt.Errorf("audit chain broken at sequence %d: %s", verification.BrokenAt, verification.Reason)
+	}
+	logger.Infof("Audit chain verified over %d records, head %d:%s", verification.Records, verification.Head.Sequence, verification.Head.Hash)
+	return nil
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/database"
+	"nymphicus-service/pkg/logger"
+	service "nymphicus-service/src/services"
+	"os/user"
+	"time"
+)
+
+// Command runs one CLI subcommand with the arguments that follow its name.
+type Command func(cfg *config.Config, logger logger.Logger, args []string) error
+
+var registry = map[string]Command{
+	"export":        Export,
+	"archive":       Archive,
+	"restore":       Restore,
+	"encryption":    Encryption,
+	"audit":         Audit,
+	"migrate":       Migrate,
+	"storage":       Storage,
+	"dev":           Dev,
+	"fake-renderer": FakeRenderer,
+}
+
+// Run dispatches args[0] to its subcommand.
+func Run(cfg *config.Config, logger logger.Logger, args []string) error {
+	command, ok := registry[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return command(cfg, logger, args[1:])
+}
+
+// store holds what commands read and write.
+type store struct {
+	*database.Stores
+	auditLog service.AuditLog
+}
+
+// openStore opens the configured storage backend. Callers close it.
+func openStore(cfg *config.Config, logger logger.Logger) (store, error) {
+	stores, err := database.OpenStores(cfg, logger)
+	if err != nil {
+		return store{}, err
+	}
+	return store{Stores: stores, auditLog: service.NewAuditLog(cfg, stores.Audit)}, nil
+}
+
+// cliActor names the operator of a command in the audit log.
+func cliActor() string {
+	if current, err := user.Current(); err == nil {
+		return "cli:" + current.Username
+	}
+	return "cli"
+}
+
+// parseDate parses an optional RFC 3339 or YYYY-MM-DD flag value.
+func parseDate(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q", name, value)
+	}
+	return t, nil
+}
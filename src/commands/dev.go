@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"flag"
+	"nymphicus-service/config"
+	"nymphicus-service/database"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/server"
+)
+
+// Dev serves the full HTTP API in-process with in-memory storage, so that it
+// runs without Mongo or Redis:
+//
+//	dev [-project <name>]
+//
+// It creates an access key for the project and logs it. Nothing is kept once
+// the server stops.
+func Dev(cfg *config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("dev", flag.ContinueOnError)
+	project := flags.String("project", "dev", "name of the project to create an access key for")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg.Storage.Backend = database.StorageMemory
+	stores, err := database.OpenStores(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	key, err := stores.AccessKeys.Create(*project)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Access key of project %s: %s", *project, key)
+
+	s, err := server.NewServer(cfg, logger, stores)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
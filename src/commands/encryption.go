@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/pkg/logger"
+	"strconv"
+)
+
+// Encryption manages the master keys of session payloads:
+//
+//	encryption new-key -id <id>  adds a master key and makes it the active one
+//	encryption rotate            re-wraps every data key with the active master key
+//
+// Rotating leaves the encrypted payloads untouched; once it completes, the
+// previous master keys can be removed from the keyfile.
+func Encryption(cfg *config.Config, logger logger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected new-key or rotate")
+	}
+	keyFile := cfg.Encryption.KeyFile
+	if keyFile == "" {
+		return errors.New("encryption.KeyFile is not configured")
+	}
+
+	switch args[0] {
+	case "new-key":
+		flags := flag.NewFlagSet("encryption new-key", flag.ContinueOnError)
+		id := flags.String("id", "", "ID of the new master key (required)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := envelope.AddKey(keyFile, *id); err != nil {
+			return err
+		}
+		logger.Infof("Master key %s added to %s and made active", *id, keyFile)
+		return nil
+	case "rotate":
+		store, err := openStore(cfg, logger)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		rewrapped, err := store.Sessions.RewrapDataKeys()
+		details := map[string]string{"rewrapped": strconv.FormatInt(rewrapped, 10)}
+		if err != nil {
+			details["error"] = err.Error()
+		}
+		if auditErr := store.auditLog.Record(cliActor(), enum.EncryptionRotate, "sessions", details); auditErr != nil && err == nil {
+			err = auditErr
+		}
+		if err != nil {
+			return err
+		}
+		logger.Infof("Re-wrapped the data keys of %d sessions", rewrapped)
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption command %q", args[0])
+	}
+}
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/repository"
+	service "nymphicus-service/src/services"
+	"os"
+)
+
+// Export writes the sessions of a project as NDJSON or CSV, with the same
+// filters as the list API. Every record carries the token -resume accepts.
+func Export(cfg *config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	key := flags.String("key", "", "project access key (required)")
+	format := flags.String("format", "ndjson", "ndjson or csv")
+	out := flags.String("out", "", "output file, stdout when empty")
+	resume := flags.String("resume", "", "resume token of the last exported record")
+	status := flags.String("status", "", "only sessions with this status")
+	signal := flags.String("signal", "", "only sessions with this frustration signal")
+	platform := flags.String("platform", "", "only sessions from this platform")
+	appVersion := flags.String("app-version", "", "only sessions from this app version")
+	from := flags.String("from", "", "only sessions created at or after this date")
+	to := flags.String("to", "", "only sessions created before this date")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *key == "" {
+		return errors.New("-key is required")
+	}
+	if err := service.ValidateExportFormat(*format); err != nil {
+		return err
+	}
+
+	filter := repository.SessionFilter{
+		Key:        *key,
+		Status:     *status,
+		Signal:     *signal,
+		Platform:   *platform,
+		AppVersion: *appVersion,
+	}
+	var err error
+	if filter.From, err = parseDate("from", *from); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate("to", *to); err != nil {
+		return err
+	}
+	if *resume != "" {
+		cursor, err := repository.DecodeSessionCursor(*resume)
+		if err != nil {
+			return err
+		}
+		filter.After = &cursor
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	details := map[string]string{"key": *key, "format": *format}
+	if *resume != "" {
+		details["resumeToken"] = *resume
+	}
+	if err := store.auditLog.Record(cliActor(), enum.SessionsExport, "sessions", details); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+
+	exporter := service.NewSessionExporter(store.Sessions)
+	if err := exporter.Export(buffered, filter, *format); err != nil {
+		_ = buffered.Flush()
+		return err
+	}
+	return buffered.Flush()
+}
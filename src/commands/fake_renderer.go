@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"errors"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/fakerenderer"
+)
+
+// FakeRenderer serves a local stand-in for Otididae, set up by the
+// FakeRenderer config, so that recordings render without the real service.
+// Point Services.OtididaeURL and OtididaeDeleteURL at it.
+func FakeRenderer(cfg *config.Config, logger logger.Logger, args []string) error {
+	if len(args) > 0 {
+		return errors.New("fake-renderer takes no arguments")
+	}
+	if cfg.FakeRenderer.Port == "" || cfg.FakeRenderer.StorageDir == "" {
+		return errors.New("FakeRenderer.Port and FakeRenderer.StorageDir must be set")
+	}
+	if cfg.FakeRenderer.FailureRate < 0 || cfg.FakeRenderer.FailureRate > 1 {
+		return errors.New("FakeRenderer.FailureRate must be between 0 and 1")
+	}
+	return fakerenderer.New(cfg.FakeRenderer, logger).Run()
+}
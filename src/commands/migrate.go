@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/database"
+	"nymphicus-service/database/migrations"
+	"nymphicus-service/pkg/logger"
+	"os"
+)
+
+// Migrate manages the Mongo schema:
+//
+//	migrate up [-to <version>]  applies the pending migrations
+//	migrate down [-steps <n>]   rolls back the last applied migrations
+//	migrate status              lists the migrations and when they were applied
+func Migrate(cfg *config.Config, logger logger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected up, down or status")
+	}
+	if backend := cfg.Storage.Backend; backend != "" && backend != database.StorageMongo {
+		return fmt.Errorf("migrations only apply to the %s backend", database.StorageMongo)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	to := flags.Int("to", 0, "last version to apply, all when zero")
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	mongoClient, err := database.ConnectionDatabase(cfg, logger)
+	if err != nil {
+		return err
+	}
+	migrator := migrations.NewMigrator(mongoClient)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(*to)
+		logger.Infof("Applied migrations %v", applied)
+		return err
+	case "down":
+		if *steps <= 0 {
+			return errors.New("-steps must be positive")
+		}
+		rolledBack, err := migrator.Down(*steps)
+		logger.Infof("Rolled back migrations %v", rolledBack)
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/src/repository/conformance"
+	"os"
+)
+
+// Storage inspects the configured storage backend:
+//
+//	storage check  runs the repository conformance checks against it
+//
+// The checks write and then delete a few sessions under random project keys.
+func Storage(cfg *config.Config, logger logger.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("expected check")
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	results, err := conformance.Run(store.Sessions)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(results); encodeErr != nil && err == nil {
+		err = encodeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d conformance checks failed", failed, len(results))
+	}
+	logger.Infof("All %d conformance checks passed", len(results))
+	return nil
+}
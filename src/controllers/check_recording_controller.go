@@ -1,13 +1,12 @@
 package controllers
 
 import (
-	"context"
 	"errors"
-	"github.com/go-redis/redis/v8"
 	"github.com/valyala/fasthttp"
 	"nymphicus-service/config"
 	"nymphicus-service/pkg/logger"
 	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src/repository"
 )
 
 type CheckRecordingController interface {
@@ -15,20 +14,20 @@ type CheckRecordingController interface {
 }
 
 type checkRecordingController struct {
-	config      *config.Config
-	logger      logger.Logger
-	redisClient *redis.Client
+	config     *config.Config
+	logger     logger.Logger
+	accessKeys repository.AccessKeyRepository
 }
 
 func NewCheckRecordingController(
 	config *config.Config,
 	logger logger.Logger,
-	redisClient *redis.Client,
+	accessKeys repository.AccessKeyRepository,
 ) CheckRecordingController {
 	return &checkRecordingController{
-		config:      config,
-		logger:      logger,
-		redisClient: redisClient,
+		config:     config,
+		logger:     logger,
+		accessKeys: accessKeys,
 	}
 }
 
@@ -39,13 +38,13 @@ func (c *checkRecordingController) ValidateAccessKey(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	exists, err := c.redisClient.Exists(context.Background(), accessKey).Result()
+	exists, err := c.accessKeys.Exists(accessKey)
 	if err != nil {
 		utils.HandleRequestError(ctx, err, c.logger)
 		return
 	}
 
-	if exists == 1 {
+	if exists {
 		ctx.SetStatusCode(fasthttp.StatusOK)
 	} else {
 		ctx.SetStatusCode(fasthttp.StatusUnauthorized)
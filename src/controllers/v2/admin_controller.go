@@ -0,0 +1,745 @@
+package controller_v2
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	service "nymphicus-service/src/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AdminController interface {
+	ArchiveSessions(ctx *fasthttp.RequestCtx)
+	RestoreSessions(ctx *fasthttp.RequestCtx)
+	ExportSubject(ctx *fasthttp.RequestCtx)
+	DeleteSubject(ctx *fasthttp.RequestCtx)
+	RetentionReport(ctx *fasthttp.RequestCtx)
+	RetentionSweep(ctx *fasthttp.RequestCtx)
+	SetLegalHold(ctx *fasthttp.RequestCtx)
+	DeleteSession(ctx *fasthttp.RequestCtx)
+	RerenderSession(ctx *fasthttp.RequestCtx)
+	CreateAccessKey(ctx *fasthttp.RequestCtx)
+	RevokeAccessKey(ctx *fasthttp.RequestCtx)
+	AuditRecords(ctx *fasthttp.RequestCtx)
+	VerifyAudit(ctx *fasthttp.RequestCtx)
+	CompleteRender(ctx *fasthttp.RequestCtx)
+	RendererStatus(ctx *fasthttp.RequestCtx)
+	RenderQueue(ctx *fasthttp.RequestCtx)
+}
+
+type adminController struct {
+	config             *config.Config
+	logger             logger.Logger
+	sessionArchiver    service.SessionArchiver
+	sessionExporter    service.SessionExporter
+	dataSubjectService service.DataSubjectService
+	auditLog           service.AuditLog
+	retentionService   service.RetentionService
+	sessionRepository  repository.SessionRepository
+	accessKeys         repository.AccessKeyRepository
+	videoService       service.VideoService
+	otididae           service.OtididaeCluster
+	renders            service.RenderScheduler
+}
+
+func NewAdminController(
+	config *config.Config,
+	logger logger.Logger,
+	sessionArchiver service.SessionArchiver,
+	sessionExporter service.SessionExporter,
+	dataSubjectService service.DataSubjectService,
+	auditLog service.AuditLog,
+	retentionService service.RetentionService,
+	sessionRepository repository.SessionRepository,
+	accessKeys repository.AccessKeyRepository,
+	videoService service.VideoService,
+	otididae service.OtididaeCluster,
+	renders service.RenderScheduler,
+) AdminController {
+	return &adminController{
+		config:             config,
+		logger:             logger,
+		sessionArchiver:    sessionArchiver,
+		sessionExporter:    sessionExporter,
+		dataSubjectService: dataSubjectService,
+		auditLog:           auditLog,
+		retentionService:   retentionService,
+		sessionRepository:  sessionRepository,
+		accessKeys:         accessKeys,
+		videoService:       videoService,
+		otididae:           otididae,
+		renders:            renders,
+	}
+}
+
+// ArchiveSessions downloads a bundle of the sessions in the 'ids' query
+// parameter, or of every session matching the list filters.
+func (c *adminController) ArchiveSessions(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	ids := splitList(string(ctx.QueryArgs().Peek("ids")))
+
+	// The bundle is streamed, so missing sessions are reported before it
+	// starts, with a proper status code.
+	for _, id := range ids {
+		if _, err := c.sessionRepository.FindSessionByID(id, filter.Key); err != nil {
+			utils.HandleRequestError(ctx, err, c.logger)
+			return
+		}
+	}
+
+	// The archive is only served once it is on record.
+	details := map[string]string{"key": filter.Key}
+	if len(ids) > 0 {
+		details["ids"] = strings.Join(ids, ",")
+	}
+	if err := c.auditLog.Record(actor, enum.SessionsArchive, "sessions", details); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("application/gzip")
+	ctx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"sessions-%s.tar.gz\"", time.Now().UTC().Format("20060102T150405Z")))
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		count, err := c.sessionArchiver.Archive(w, filter, ids)
+		if err != nil {
+			c.logger.Errorf("ArchiveSessions, Key: %s, Error: %s", filter.Key, err)
+			return
+		}
+		c.logger.Infof("ArchiveSessions, Key: %s, archived %d sessions", filter.Key, count)
+	})
+}
+
+// RestoreSessions imports the bundle in the request body into the project of
+// the 'key' query parameter and returns the new session IDs. The body is read
+// as a stream, so bundles are not bound by the request body size limit.
+func (c *adminController) RestoreSessions(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	key := string(ctx.QueryArgs().Peek("key"))
+	if len(key) == 0 {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'key' query parameter"), c.logger)
+		return
+	}
+
+	restored, err := c.sessionArchiver.Restore(requestBody(ctx), key)
+	details := map[string]string{"key": key, "restored": fmt.Sprint(len(restored))}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	if auditErr := c.auditLog.Record(actor, enum.SessionsRestore, "sessions", details); auditErr != nil {
+		c.logger.Errorf("RestoreSessions, audit record failed: %s", auditErr)
+		if err == nil {
+			err = auditErr
+		}
+	}
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, restored)
+}
+
+// ExportSubject streams as NDJSON every session recorded by the install in the
+// 'installId' query parameter, within the project of 'key' if given.
+func (c *adminController) ExportSubject(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	installID, key, err := parseSubject(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	filter := c.dataSubjectService.Filter(installID, key)
+
+	// The export is only served once it is on record.
+	details := map[string]string{"key": filter.Key}
+	if err := c.auditLog.Record(actor, enum.SubjectExport, subjectTarget(installID), details); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("application/x-ndjson")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := c.sessionExporter.Export(w, filter, "ndjson"); err != nil {
+			c.logger.Errorf("ExportSubject, Target: %s, Error: %s", subjectTarget(installID), err)
+		}
+	})
+}
+
+// DeleteSubject hard-deletes every session recorded by the install in the
+// 'installId' query parameter, within the project of 'key' if given, along
+// with their rendered videos.
+func (c *adminController) DeleteSubject(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsDelete() && !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	installID, key, err := parseSubject(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	// The erasure only starts once it is on record; its outcome follows.
+	target := subjectTarget(installID)
+	if err := c.auditLog.Record(actor, enum.SubjectDelete, target, map[string]string{"key": key, "status": "started"}); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	report, err := c.dataSubjectService.Delete(installID, key)
+	details := map[string]string{
+		"key":     key,
+		"status":  "done",
+		"matched": fmt.Sprint(report.Matched),
+		"deleted": fmt.Sprint(report.Deleted),
+		"failed":  fmt.Sprint(len(report.Failed)),
+		"held":    fmt.Sprint(len(report.Held)),
+	}
+	if err != nil {
+		details["status"], details["error"] = "failed", err.Error()
+	}
+	if auditErr := c.auditLog.Record(actor, enum.SubjectDelete, target, details); auditErr != nil {
+		c.logger.Errorf("DeleteSubject, audit record failed: %s", auditErr)
+	}
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, report)
+}
+
+// RetentionReport lists what the next retention sweep would purge.
+func (c *adminController) RetentionReport(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorize(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	report, err := c.retentionService.Sweep(true)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, report)
+}
+
+// RetentionSweep expires the sessions past retention right away.
+func (c *adminController) RetentionSweep(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	// The sweep only starts once it is on record; its outcome follows.
+	if err := c.auditLog.Record(actor, enum.RetentionSweep, "sessions", map[string]string{"status": "started"}); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	report, err := c.retentionService.Sweep(false)
+	if auditErr := c.auditLog.Record(actor, enum.RetentionSweep, "sessions", service.RetentionAuditDetails(report, err)); auditErr != nil {
+		c.logger.Errorf("RetentionSweep, audit record failed: %s", auditErr)
+	}
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, report)
+}
+
+// SetLegalHold puts the session in the 'id' query parameter on legal hold, or
+// releases it with hold=false, so that retention skips it.
+func (c *adminController) SetLegalHold(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	key, id := string(args.Peek("key")), string(args.Peek("id"))
+	if key == "" || id == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'key' or 'id' query parameter"), c.logger)
+		return
+	}
+	hold := string(args.Peek("hold")) != "false"
+
+	if err := c.sessionRepository.SetLegalHold(id, key, hold); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	action := enum.LegalHoldSet
+	if !hold {
+		action = enum.LegalHoldRelease
+	}
+	if err := c.auditLog.Record(actor, action, "session:"+id, map[string]string{"key": key}); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, map[string]interface{}{"id": id, "legalHold": hold})
+}
+
+// DeleteSession hard-deletes the session in the 'id' query parameter of the
+// project of 'key', along with its rendered video.
+func (c *adminController) DeleteSession(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsDelete() && !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	key, id := string(args.Peek("key")), string(args.Peek("id"))
+	if key == "" || id == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'key' or 'id' query parameter"), c.logger)
+		return
+	}
+	session, err := c.sessionRepository.FindSessionByID(id, key)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if session.LegalHold {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("session is on legal hold"), c.logger)
+		return
+	}
+
+	// The deletion cannot be undone, so it only happens once it is on record.
+	if err := c.auditLog.Record(actor, enum.SessionDelete, "session:"+id, map[string]string{"key": key}); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if err := c.videoService.DeleteVideo(key, id); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if _, err := c.sessionRepository.DeleteSessionsByID([]string{id}); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// RerenderSession renders the session in the 'id' query parameter of the
+// project of 'key' again, from the recording uploaded in the 'file' form field
+// since recordings are not kept once rendered. The stored, already masked,
+// gestures are used and the current video is replaced when the render is done.
+func (c *adminController) RerenderSession(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	key, id := string(args.Peek("key")), string(args.Peek("id"))
+	if key == "" || id == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'key' or 'id' query parameter"), c.logger)
+		return
+	}
+	priority, err := c.videoService.RenderPriority(key, string(args.Peek("priority")))
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	multipartForm, err := ctx.MultipartForm()
+	if err != nil {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("expected a multipart form with the recording"), c.logger)
+		return
+	}
+	fileHeader, err := extractFile(multipartForm)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	session, err := c.sessionRepository.FindSessionByID(id, key)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if err := c.sessionRepository.RestartRender(id, key); err != nil {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("session is not rendered, failed or is being rendered"), c.logger)
+		return
+	}
+	if err := c.auditLog.Record(actor, enum.RenderRequest, "session:"+id, map[string]string{"key": key, "priority": priority}); err != nil {
+		if completeErr := c.sessionRepository.CompleteRender(id, session.VideoUrl); completeErr != nil {
+			c.logger.Errorf("RerenderSession, restore after failed audit: %s", completeErr)
+		}
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	duration := strconv.FormatInt(session.Duration, 10)
+	if err := c.videoService.RequestGenerateVideo(key, priority, fileHeader, session.Activities, session.Masks, id, duration); err != nil {
+		if completeErr := c.sessionRepository.CompleteRender(id, nil); completeErr != nil {
+			c.logger.Errorf("RerenderSession, update status to error: %s", completeErr)
+		}
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusAccepted, map[string]string{"id": id, "priority": priority})
+}
+
+// CreateAccessKey creates an access key for the project named in the 'name'
+// query parameter. The key is only ever returned by this call.
+func (c *adminController) CreateAccessKey(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	name := string(ctx.QueryArgs().Peek("name"))
+	if name == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'name' query parameter"), c.logger)
+		return
+	}
+
+	key, err := c.accessKeys.Create(name)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if err := c.auditLog.Record(actor, enum.AccessKeyCreate, accessKeyTarget(key), map[string]string{"name": name}); err != nil {
+		// A key that is not on record must not be handed out.
+		if _, revokeErr := c.accessKeys.Revoke(key); revokeErr != nil {
+			c.logger.Errorf("CreateAccessKey, revoke after failed audit: %s", revokeErr)
+		}
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusCreated, map[string]string{"name": name, "key": key})
+}
+
+// RevokeAccessKey deletes the access key in the 'key' query parameter. The
+// sessions already recorded with it are kept.
+func (c *adminController) RevokeAccessKey(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorize(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsDelete() && !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	key := string(ctx.QueryArgs().Peek("key"))
+	if key == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'key' query parameter"), c.logger)
+		return
+	}
+
+	revoked, err := c.accessKeys.Revoke(key)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !revoked {
+		utils.HandleRequestError(ctx, httpErrors.NewNotFoundError("unknown access key"), c.logger)
+		return
+	}
+	if err := c.auditLog.Record(actor, enum.AccessKeyRevoke, accessKeyTarget(key), nil); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// AuditRecords lists the audit log in sequence order, filtered by the 'actor',
+// 'action', 'target', 'from' and 'to' query parameters. Pages continue after
+// the 'after' sequence number.
+func (c *adminController) AuditRecords(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorize(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	filter := repository.AuditFilter{
+		Actor:  string(args.Peek("actor")),
+		Action: string(args.Peek("action")),
+		Target: string(args.Peek("target")),
+	}
+	var err error
+	if filter.From, err = parseDateParam(ctx, "from"); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if filter.To, err = parseDateParam(ctx, "to"); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if after := string(args.Peek("after")); after != "" {
+		if filter.AfterSequence, err = strconv.ParseInt(after, 10, 64); err != nil || filter.AfterSequence < 0 {
+			utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("invalid 'after' query parameter"), c.logger)
+			return
+		}
+	}
+	limit, err := parseIntParam(ctx, "limit", 100, 1000)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	filter.Limit = int64(limit)
+
+	records, err := c.auditLog.Find(filter)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, records)
+}
+
+// VerifyAudit checks the hash chain of the whole audit log, against the
+// optional anchor=sequence:hash kept from the head of a previous check.
+func (c *adminController) VerifyAudit(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorize(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	var anchor service.AuditAnchor
+	if value := string(ctx.QueryArgs().Peek("anchor")); value != "" {
+		parsed, err := service.ParseAuditAnchor(value)
+		if err != nil {
+			utils.HandleRequestError(ctx, httpErrors.NewBadRequestError(err.Error()), c.logger)
+			return
+		}
+		anchor = parsed
+	}
+
+	verification, err := c.auditLog.Verify(anchor)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, verification)
+}
+
+// CompleteRender is the callback of the renderer: it records the
+// models.RenderCompletion in the body as the render result of its session.
+// Only sessions still in progress are updated. The video of a session deleted
+// while it was rendering is deleted in turn. The renderer authenticates with
+// Rendering.CallbackToken; results are not audited.
+func (c *adminController) CompleteRender(ctx *fasthttp.RequestCtx) {
+	if err := c.authorizeCallback(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	var completion models.RenderCompletion
+	if err := json.Unmarshal(ctx.PostBody(), &completion); err != nil {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("invalid render completion: "+err.Error()), c.logger)
+		return
+	}
+	if completion.SessionID == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'sessionId'"), c.logger)
+		return
+	}
+
+	var videoURL *string
+	status := enum.Error.String()
+	if completion.Error == "" && completion.VideoURL != "" {
+		videoURL, status = &completion.VideoURL, enum.Complete.String()
+	} else {
+		c.logger.Warnf("Render of session %s failed: %s", completion.SessionID, completion.Error)
+	}
+	if err := c.sessionRepository.CompleteRender(completion.SessionID, videoURL); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) && videoURL != nil {
+			c.deleteOrphanedVideo(completion.SessionID)
+		}
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, map[string]string{"id": completion.SessionID, "status": status})
+}
+
+// deleteOrphanedVideo deletes the video rendered for sessionId unless the
+// session still exists, in which case the video is the one it was completed
+// with, reported again.
+func (c *adminController) deleteOrphanedVideo(sessionId string) {
+	exists, err := c.sessionRepository.SessionExists(sessionId)
+	if err != nil {
+		c.logger.Errorf("CompleteRender, lookup of session %s failed: %s", sessionId, err)
+		return
+	}
+	if exists {
+		return
+	}
+	if err := c.videoService.DeleteOrphanedVideo(sessionId); err != nil {
+		c.logger.Errorf("CompleteRender, deleting the video of deleted session %s failed: %s", sessionId, err)
+	}
+}
+
+// RendererStatus lists the Otididae endpoints with their health, circuit
+// breaker state and requests in flight.
+func (c *adminController) RendererStatus(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorize(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, c.otididae.Status())
+}
+
+// RenderQueue reports the queued renders of each priority class and how many
+// are being dispatched.
+func (c *adminController) RenderQueue(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorize(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, c.renders.Status())
+}
+
+// accessKeyTarget identifies an access key in the audit log without keeping
+// the key itself.
+func accessKeyTarget(key string) string {
+	return "access-key:" + utils.GenerateSHA1(key)
+}
+
+// parseSubject reads the raw install ID and the optional project key of a
+// data-subject request.
+func parseSubject(ctx *fasthttp.RequestCtx) (string, string, error) {
+	installID := string(ctx.QueryArgs().Peek("installId"))
+	if installID == "" {
+		return "", "", httpErrors.NewBadRequestError("missing 'installId' query parameter")
+	}
+	return installID, string(ctx.QueryArgs().Peek("key")), nil
+}
+
+// subjectTarget identifies a data subject in the audit log without keeping
+// the install ID itself.
+func subjectTarget(installID string) string {
+	return "install:" + utils.GenerateSHA1(installID)
+}
+
+// authorize checks the bearer token against Admin.Tokens and returns the name
+// of the matching token.
+func (c *adminController) authorize(ctx *fasthttp.RequestCtx) (string, error) {
+	if name, ok := matchBearerToken(ctx, c.config.Admin.Tokens); ok {
+		return name, nil
+	}
+	return "", httpErrors.NewUnauthorizedError("invalid admin token")
+}
+
+// matchBearerToken returns the name of the token of tokenLists given as
+// bearer token, if any.
+func matchBearerToken(ctx *fasthttp.RequestCtx, tokenLists ...[]config.AdminToken) (string, bool) {
+	token, ok := bytes.CutPrefix(ctx.Request.Header.Peek("Authorization"), []byte("Bearer "))
+	if !ok || len(token) == 0 {
+		return "", false
+	}
+	for _, tokens := range tokenLists {
+		for _, candidate := range tokens {
+			if candidate.Token != "" && subtle.ConstantTimeCompare(token, []byte(candidate.Token)) == 1 {
+				return candidate.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// authorizeCallback checks the bearer token against Rendering.CallbackToken.
+// Admin tokens are not accepted, and the callback token is nothing else.
+func (c *adminController) authorizeCallback(ctx *fasthttp.RequestCtx) error {
+	token, ok := bytes.CutPrefix(ctx.Request.Header.Peek("Authorization"), []byte("Bearer "))
+	expected := c.config.Rendering.CallbackToken
+	if ok && expected != "" && subtle.ConstantTimeCompare(token, []byte(expected)) == 1 {
+		return nil
+	}
+	return httpErrors.NewUnauthorizedError("invalid callback token")
+}
+
+// requestBody reads the body of ctx as it arrives when the server streams
+// request bodies.
+func requestBody(ctx *fasthttp.RequestCtx) io.Reader {
+	if ctx.Request.IsBodyStream() {
+		return ctx.RequestBodyStream()
+	}
+	return bytes.NewReader(ctx.PostBody())
+}
@@ -0,0 +1,250 @@
+package controller_v2
+
+import (
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	service "nymphicus-service/src/services"
+	"strconv"
+	"strings"
+)
+
+type AnalyticsController interface {
+	SignalsByActivity(ctx *fasthttp.RequestCtx)
+	ScreenFlow(ctx *fasthttp.RequestCtx)
+	Funnel(ctx *fasthttp.RequestCtx)
+	Heatmap(ctx *fasthttp.RequestCtx)
+}
+
+type analyticsController struct {
+	config            *config.Config
+	logger            logger.Logger
+	sessionRepository repository.SessionRepository
+	gestureClassifier service.GestureClassifier
+}
+
+func NewAnalyticsController(
+	config *config.Config,
+	logger logger.Logger,
+	sessionRepository repository.SessionRepository,
+	gestureClassifier service.GestureClassifier,
+) AnalyticsController {
+	return &analyticsController{
+		config:            config,
+		logger:            logger,
+		sessionRepository: sessionRepository,
+		gestureClassifier: gestureClassifier,
+	}
+}
+
+// SignalsByActivity counts the frustration signals of a project per activity and type.
+func (c *analyticsController) SignalsByActivity(ctx *fasthttp.RequestCtx) {
+	key := string(ctx.QueryArgs().Peek("key"))
+	if len(key) == 0 {
+		utils.HandleRequestError(ctx, errors.New("missing 'key' query parameter"), c.logger)
+		return
+	}
+
+	counts, err := c.sessionRepository.CountSignalsByActivity(key)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, counts)
+}
+
+// ScreenFlow aggregates the activity sequences of the matching sessions into
+// a navigation graph with time on screen.
+func (c *analyticsController) ScreenFlow(ctx *fasthttp.RequestCtx) {
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	builder := service.NewScreenFlowBuilder()
+	err = c.sessionRepository.IterateSessions(filter, func(session models.Session) error {
+		builder.Add(session.Activities)
+		return nil
+	})
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, builder.Build())
+}
+
+// Funnel reports conversion through the activities of the 'steps' query
+// parameter. 'maxGaps' optionally holds one millisecond bound per transition,
+// both comma separated.
+func (c *analyticsController) Funnel(ctx *fasthttp.RequestCtx) {
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	definitions, err := parseFunnelSteps(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	builder := service.NewFunnelBuilder(definitions)
+	err = c.sessionRepository.IterateSessions(filter, func(session models.Session) error {
+		builder.Add(session.ID, session.Activities)
+		return nil
+	})
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, builder.Build())
+}
+
+func parseFunnelSteps(ctx *fasthttp.RequestCtx) ([]service.FunnelStepDefinition, error) {
+	steps := splitList(string(ctx.QueryArgs().Peek("steps")))
+	if len(steps) == 0 {
+		return nil, httpErrors.NewBadRequestError("missing 'steps' query parameter")
+	}
+
+	var gaps []string
+	if value := string(ctx.QueryArgs().Peek("maxGaps")); value != "" {
+		gaps = strings.Split(value, ",")
+	}
+	if len(gaps) > len(steps)-1 {
+		return nil, httpErrors.NewBadRequestError(fmt.Sprintf("expected at most %d 'maxGaps' values", len(steps)-1))
+	}
+
+	definitions := make([]service.FunnelStepDefinition, len(steps))
+	for i, step := range steps {
+		definitions[i].Activity = step
+	}
+	for i, gap := range gaps {
+		if gap = strings.TrimSpace(gap); gap == "" {
+			continue
+		}
+		maxGap, err := strconv.ParseInt(gap, 10, 64)
+		if err != nil || maxGap < 0 {
+			return nil, httpErrors.NewBadRequestError(fmt.Sprintf("invalid 'maxGaps' value %q", gap))
+		}
+		definitions[i+1].MaxGap = maxGap
+	}
+	return definitions, nil
+}
+
+const (
+	defaultHeatmapColumns = 36
+	defaultHeatmapRows    = 64
+	defaultHeatmapWidth   = 360
+	maxHeatmapCells       = 512
+	maxHeatmapPixels      = 4096
+)
+
+// Heatmap aggregates the taps on the 'activity' query parameter into a PNG,
+// or a JSON density grid with format=json. Taps are normalized by screen size
+// unless 'resolution' selects the devices recorded at that resolution.
+func (c *analyticsController) Heatmap(ctx *fasthttp.RequestCtx) {
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	args := ctx.QueryArgs()
+	activity := string(args.Peek("activity"))
+	if activity == "" {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("missing 'activity' query parameter"), c.logger)
+		return
+	}
+	resolution := string(args.Peek("resolution"))
+	if _, _, ok := (models.Device{ScreenResolution: resolution}).ScreenSize(); resolution != "" && !ok {
+		utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("invalid 'resolution' query parameter"), c.logger)
+		return
+	}
+
+	columns, err := parseIntParam(ctx, "columns", defaultHeatmapColumns, maxHeatmapCells)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	rows, err := parseIntParam(ctx, "rows", defaultHeatmapRows, maxHeatmapCells)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	builder := service.NewHeatmapBuilder(activity, resolution, columns, rows)
+	err = c.sessionRepository.IterateSessions(filter, func(session models.Session) error {
+		events := session.Events
+		if len(events) == 0 {
+			events = c.gestureClassifier.Classify(session.Activities)
+		}
+		builder.Add(session.Device, events)
+		return nil
+	})
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	heatmap := builder.Build()
+
+	if string(args.Peek("format")) == "json" {
+		utils.RespondWithJSON(ctx, fasthttp.StatusOK, heatmap)
+		return
+	}
+
+	width, err := parseIntParam(ctx, "width", defaultHeatmapWidth, maxHeatmapPixels)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	height, err := parseIntParam(ctx, "height", max(1, min(width*rows/columns, maxHeatmapPixels)), maxHeatmapPixels)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	image, err := service.RenderHeatmapPNG(heatmap, width, height)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("image/png")
+	ctx.SetBody(image)
+}
+
+// parseIntParam parses an optional positive integer query parameter up to limit.
+func parseIntParam(ctx *fasthttp.RequestCtx, name string, fallback int, limit int) (int, error) {
+	value := string(ctx.QueryArgs().Peek(name))
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || n > limit {
+		return 0, httpErrors.NewBadRequestError(fmt.Sprintf("invalid '%s' query parameter", name))
+	}
+	return n, nil
+}
+
+// splitList splits a comma separated query value, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
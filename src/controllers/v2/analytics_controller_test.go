@@ -0,0 +1,40 @@
+package controller_v2
+
+import (
+	"github.com/valyala/fasthttp"
+	"nymphicus-service/pkg/httpErrors"
+	service "nymphicus-service/src/services"
+	"reflect"
+	"testing"
+)
+
+func requestWithQuery(query string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/v2/analytics/funnel?" + query)
+	return ctx
+}
+
+func TestParseFunnelSteps(t *testing.T) {
+	definitions, err := parseFunnelSteps(requestWithQuery("steps=Home,Cart,Pay&maxGaps=,3000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []service.FunnelStepDefinition{{Activity: "Home"}, {Activity: "Cart"}, {Activity: "Pay", MaxGap: 3000}}
+	if !reflect.DeepEqual(definitions, want) {
+		t.Errorf("definitions = %+v, want %+v", definitions, want)
+	}
+}
+
+func TestParseFunnelStepsRejectsGaps(t *testing.T) {
+	for _, query := range []string{
+		"maxGaps=1000",
+		"steps=Home,Cart&maxGaps=1000,2000",
+		"steps=Home,Cart&maxGaps=-1",
+		"steps=Home,Cart&maxGaps=soon",
+	} {
+		_, err := parseFunnelSteps(requestWithQuery(query))
+		if _, ok := err.(httpErrors.RestErr); !ok {
+			t.Errorf("%s: error %v, want a bad request", query, err)
+		}
+	}
+}
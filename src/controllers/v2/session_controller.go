@@ -0,0 +1,340 @@
+package controller_v2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	service "nymphicus-service/src/services"
+	"strconv"
+	"time"
+)
+
+type SessionController interface {
+	GetSession(ctx *fasthttp.RequestCtx)
+	ListSessions(ctx *fasthttp.RequestCtx)
+	ExportSession(ctx *fasthttp.RequestCtx)
+	ReproductionSteps(ctx *fasthttp.RequestCtx)
+	Timeline(ctx *fasthttp.RequestCtx)
+	Manifest(ctx *fasthttp.RequestCtx)
+	ExportSessions(ctx *fasthttp.RequestCtx)
+}
+
+type sessionController struct {
+	config              *config.Config
+	logger              logger.Logger
+	sessionRepository   repository.SessionRepository
+	gestureClassifier   service.GestureClassifier
+	frustrationDetector service.FrustrationDetector
+	scriptExporter      service.ScriptExporter
+	reproductionSteps   service.ReproductionSteps
+	sessionTimeline     service.SessionTimeline
+	manifestBuilder     service.ReplayManifestBuilder
+	sessionExporter     service.SessionExporter
+	auditLog            service.AuditLog
+}
+
+func NewSessionController(
+	config *config.Config,
+	logger logger.Logger,
+	sessionRepository repository.SessionRepository,
+	gestureClassifier service.GestureClassifier,
+	frustrationDetector service.FrustrationDetector,
+	scriptExporter service.ScriptExporter,
+	reproductionSteps service.ReproductionSteps,
+	sessionTimeline service.SessionTimeline,
+	manifestBuilder service.ReplayManifestBuilder,
+	sessionExporter service.SessionExporter,
+	auditLog service.AuditLog,
+) SessionController {
+	return &sessionController{
+		config:              config,
+		logger:              logger,
+		sessionRepository:   sessionRepository,
+		gestureClassifier:   gestureClassifier,
+		frustrationDetector: frustrationDetector,
+		scriptExporter:      scriptExporter,
+		reproductionSteps:   reproductionSteps,
+		sessionTimeline:     sessionTimeline,
+		manifestBuilder:     manifestBuilder,
+		sessionExporter:     sessionExporter,
+		auditLog:            auditLog,
+	}
+}
+
+func (c *sessionController) GetSession(ctx *fasthttp.RequestCtx) {
+	session, err := c.loadSession(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, session)
+}
+
+// ExportSession writes the session as a test script in the 'format' query parameter.
+func (c *sessionController) ExportSession(ctx *fasthttp.RequestCtx) {
+	session, err := c.loadSession(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	format := string(ctx.QueryArgs().Peek("format"))
+	script, err := c.scriptExporter.Export(session, string(ctx.QueryArgs().Peek("appId")), format)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.ID+scriptExtensions[format]))
+	ctx.SetBodyString(script)
+}
+
+// ReproductionSteps writes the session as numbered steps in the 'format'
+// query parameter, text or markdown.
+func (c *sessionController) ReproductionSteps(ctx *fasthttp.RequestCtx) {
+	session, err := c.loadSession(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	format := string(ctx.QueryArgs().Peek("format"))
+	steps, err := c.reproductionSteps.Write(session, format)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if format == "markdown" {
+		ctx.SetContentType("text/markdown; charset=utf-8")
+	} else {
+		ctx.SetContentType("text/plain; charset=utf-8")
+	}
+	ctx.SetBodyString(steps)
+}
+
+// Timeline writes one subtitle cue per activity change and gesture, as WebVTT
+// or SRT depending on the 'format' path value.
+func (c *sessionController) Timeline(ctx *fasthttp.RequestCtx) {
+	session, err := c.loadSession(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	entries := c.sessionTimeline.Build(session)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if ctx.UserValue("format") == "srt" {
+		ctx.SetContentType("application/x-subrip; charset=utf-8")
+		ctx.SetBodyString(c.sessionTimeline.WriteSRT(entries))
+		return
+	}
+	ctx.SetContentType("text/vtt; charset=utf-8")
+	ctx.SetBodyString(c.sessionTimeline.WriteWebVTT(entries))
+}
+
+// Manifest returns the replay manifest in the 'version' query parameter,
+// the latest one by default.
+func (c *sessionController) Manifest(ctx *fasthttp.RequestCtx) {
+	session, err := c.loadSession(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	version := models.ReplayManifestVersion
+	if value := ctx.QueryArgs().Peek("version"); len(value) > 0 {
+		if version, err = strconv.Atoi(string(value)); err != nil {
+			utils.HandleRequestError(ctx, httpErrors.NewBadRequestError("invalid 'version' query parameter"), c.logger)
+			return
+		}
+	}
+
+	manifest, err := c.manifestBuilder.Build(session, version)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, manifest)
+}
+
+var scriptExtensions = map[string]string{
+	"maestro":       ".yaml",
+	"appium-python": ".py",
+	"adb":           ".sh",
+}
+
+// authorizeRead checks the bearer token against Admin.ReadTokens and
+// Admin.Tokens and returns the name of the matching token. The project key
+// alone is embedded in apps and reads nothing.
+func (c *sessionController) authorizeRead(ctx *fasthttp.RequestCtx) (string, error) {
+	if name, ok := matchBearerToken(ctx, c.config.Admin.ReadTokens, c.config.Admin.Tokens); ok {
+		return name, nil
+	}
+	return "", httpErrors.NewUnauthorizedError("invalid read token")
+}
+
+// loadSession authorizes the request and finds the session of the 'id' path
+// parameter within the project of the 'key' query parameter.
+func (c *sessionController) loadSession(ctx *fasthttp.RequestCtx) (models.Session, error) {
+	if _, err := c.authorizeRead(ctx); err != nil {
+		return models.Session{}, err
+	}
+	key := string(ctx.QueryArgs().Peek("key"))
+	if len(key) == 0 {
+		return models.Session{}, errors.New("missing 'key' query parameter")
+	}
+
+	id, _ := ctx.UserValue("id").(string)
+	session, err := c.sessionRepository.FindSessionByID(id, key)
+	if err != nil {
+		return session, err
+	}
+
+	// Sessions stored before gesture classification existed have no events yet.
+	if len(session.Events) == 0 {
+		session.Events = c.gestureClassifier.Classify(session.Activities)
+		session.Signals = c.frustrationDetector.Detect(session.Activities, session.Events)
+		session.SignalCount = len(session.Signals)
+	}
+	return session, nil
+}
+
+func (c *sessionController) ListSessions(ctx *fasthttp.RequestCtx) {
+	if _, err := c.authorizeRead(ctx); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	sessions, err := c.sessionRepository.FindSessions(filter)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusOK, sessions)
+}
+
+// ExportSessions streams the sessions matching the list filters as NDJSON or
+// CSV, resuming after the 'resumeToken' query parameter when given.
+func (c *sessionController) ExportSessions(ctx *fasthttp.RequestCtx) {
+	actor, err := c.authorizeRead(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	filter, err := parseSessionFilter(ctx)
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+	if token := string(ctx.QueryArgs().Peek("resumeToken")); token != "" {
+		cursor, err := repository.DecodeSessionCursor(token)
+		if err != nil {
+			utils.HandleRequestError(ctx, httpErrors.NewBadRequestError(err.Error()), c.logger)
+			return
+		}
+		filter.After = &cursor
+	}
+
+	format := string(ctx.QueryArgs().Peek("format"))
+	if format == "" {
+		format = "ndjson"
+	}
+	if err := service.ValidateExportFormat(format); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	// Bulk exports are data exports too, recorded under the token reading.
+	details := map[string]string{"key": accessKeyTarget(filter.Key), "format": format}
+	if filter.After != nil {
+		details["resumeToken"] = filter.After.Encode()
+	}
+	if err := c.auditLog.Record(actor, enum.SessionsExport, "sessions", details); err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if format == "csv" {
+		ctx.SetContentType("text/csv; charset=utf-8")
+	} else {
+		ctx.SetContentType("application/x-ndjson")
+	}
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := c.sessionExporter.Export(w, filter, format); err != nil {
+			c.logger.Errorf("ExportSessions, Key: %s, Error: %s", filter.Key, err)
+		}
+	})
+}
+
+// parseSessionFilter reads the session filter from the query string.
+func parseSessionFilter(ctx *fasthttp.RequestCtx) (repository.SessionFilter, error) {
+	args := ctx.QueryArgs()
+	filter := repository.SessionFilter{
+		Key:        string(args.Peek("key")),
+		Status:     string(args.Peek("status")),
+		Signal:     string(args.Peek("signal")),
+		Platform:   string(args.Peek("platform")),
+		AppVersion: string(args.Peek("appVersion")),
+	}
+	if len(filter.Key) == 0 {
+		return filter, errors.New("missing 'key' query parameter")
+	}
+
+	var err error
+	if filter.From, err = parseDateParam(ctx, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDateParam(ctx, "to"); err != nil {
+		return filter, err
+	}
+	if limit := args.Peek("limit"); len(limit) > 0 {
+		if filter.Limit, err = strconv.ParseInt(string(limit), 10, 64); err != nil {
+			return filter, httpErrors.NewBadRequestError("invalid 'limit' query parameter")
+		}
+	}
+	if skip := args.Peek("skip"); len(skip) > 0 {
+		if filter.Skip, err = strconv.ParseInt(string(skip), 10, 64); err != nil {
+			return filter, httpErrors.NewBadRequestError("invalid 'skip' query parameter")
+		}
+	}
+	return filter, nil
+}
+
+// parseDateParam parses an optional RFC 3339 or YYYY-MM-DD query parameter.
+func parseDateParam(ctx *fasthttp.RequestCtx, name string) (time.Time, error) {
+	value := string(ctx.QueryArgs().Peek(name))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, httpErrors.NewBadRequestError(fmt.Sprintf("invalid '%s' query parameter", name))
+	}
+	return t, nil
+}
@@ -25,10 +25,14 @@ type WriteVideoDataController interface {
 }
 
 type writeVideoData struct {
-	config            *config.Config
-	logger            logger.Logger
-	sessionRepository repository.SessionRepository
-	videoService      service.VideoService
+	config              *config.Config
+	logger              logger.Logger
+	sessionRepository   repository.SessionRepository
+	videoService        service.VideoService
+	gestureClassifier   service.GestureClassifier
+	frustrationDetector service.FrustrationDetector
+	devicePrivacy       service.DevicePrivacy
+	activityMasking     service.ActivityMasking
 }
 
 func NewWriteVideoDataController(
@@ -36,12 +40,20 @@ func NewWriteVideoDataController(
 	logger logger.Logger,
 	sessionRepository repository.SessionRepository,
 	videoService service.VideoService,
+	gestureClassifier service.GestureClassifier,
+	frustrationDetector service.FrustrationDetector,
+	devicePrivacy service.DevicePrivacy,
+	activityMasking service.ActivityMasking,
 ) WriteVideoDataController {
 	return &writeVideoData{
-		config:            config,
-		logger:            logger,
-		sessionRepository: sessionRepository,
-		videoService:      videoService,
+		config:              config,
+		logger:              logger,
+		sessionRepository:   sessionRepository,
+		videoService:        videoService,
+		gestureClassifier:   gestureClassifier,
+		frustrationDetector: frustrationDetector,
+		devicePrivacy:       devicePrivacy,
+		activityMasking:     activityMasking,
 	}
 }
 
@@ -51,6 +63,11 @@ func (c *writeVideoData) WriteVideoData(ctx *fasthttp.RequestCtx) {
 		utils.HandleRequestError(ctx, errors.New("missing 'key' query parameter"), c.logger)
 		return
 	}
+	priority, err := c.videoService.RenderPriority(key, string(ctx.QueryArgs().Peek("priority")))
+	if err != nil {
+		utils.HandleRequestError(ctx, err, c.logger)
+		return
+	}
 
 	multipartForm, err := ctx.MultipartForm()
 	if err != nil {
@@ -64,7 +81,7 @@ func (c *writeVideoData) WriteVideoData(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	device, err := extractDeviceData(multipartForm)
+	device, privacyPolicy, err := extractDeviceData(multipartForm, key, c.devicePrivacy)
 	if err != nil {
 		utils.HandleRequestError(ctx, err, c.logger)
 		return
@@ -82,11 +99,18 @@ func (c *writeVideoData) WriteVideoData(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	activityGesture, masks := c.activityMasking.Apply(key, activityGesture, device, duration)
+
 	session, err := createSession(key, device, duration, activityGesture)
 	if err != nil {
 		utils.HandleRequestError(ctx, err, c.logger)
 		return
 	}
+	session.Privacy = &privacyPolicy
+	session.Masks = masks
+	session.Events = c.gestureClassifier.Classify(activityGesture)
+	session.Signals = c.frustrationDetector.Detect(activityGesture, session.Events)
+	session.SignalCount = len(session.Signals)
 
 	err = c.sessionRepository.SaveActionsToMongo(session)
 	if err != nil {
@@ -94,14 +118,14 @@ func (c *writeVideoData) WriteVideoData(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	go func() {
-		if err := c.videoService.RequestGenerateVideo(fileHeader, activityGesture, session.ID, strconv.FormatInt(duration, 10)); err != nil {
-			if err := c.sessionRepository.UpdateSessionStatusToError(key); err != nil {
-				log.Printf("Failed to update session status to error: %v", err)
-			}
-			log.Printf("Failed to generate video: %v", err)
+	// The recording is spooled before the request ends; rendering happens
+	// when the scheduler gets to it.
+	if err := c.videoService.RequestGenerateVideo(key, priority, fileHeader, activityGesture, masks, session.ID, strconv.FormatInt(duration, 10)); err != nil {
+		if err := c.sessionRepository.CompleteRender(session.ID, nil); err != nil {
+			log.Printf("Failed to update session status to error: %v", err)
 		}
-	}()
+		log.Printf("Failed to generate video: %v", err)
+	}
 
 	response := fmt.Sprintf("File received: %s\nDevice: %+v\nActivity Gesture Logs: %+v\nDuration: %d", fileHeader.Filename, device, activityGesture, duration)
 	ctx.SetStatusCode(fasthttp.StatusOK)
@@ -146,17 +170,18 @@ func extractFile(form *multipart.Form) (*multipart.FileHeader, error) {
 	return getFileHeader(form, "file")
 }
 
-// extractDeviceData extracts device data from the multipart form.
-func extractDeviceData(form *multipart.Form) (models.Device, error) {
+// extractDeviceData extracts device data from the multipart form and applies
+// the privacy settings of the project of key.
+func extractDeviceData(form *multipart.Form, key string, devicePrivacy service.DevicePrivacy) (models.Device, models.PrivacyPolicy, error) {
 	var device models.Device
 	deviceData, err := getFormValue(form, "device")
 	if err != nil {
-		return device, err
+		return device, models.PrivacyPolicy{}, err
 	}
 	if err := json.Unmarshal([]byte(deviceData), &device); err != nil {
-		return device, fmt.Errorf("failed to parse device data")
+		return device, models.PrivacyPolicy{}, fmt.Errorf("failed to parse device data")
 	}
-	return device, nil
+	return devicePrivacy.Apply(key, device)
 }
 
 // extractDurationData extracts duration data from the multipart form.
@@ -0,0 +1,299 @@
+// Package fakerenderer is a local stand-in for Otididae. It accepts the
+// multipart contract of the http renderer, checks it, stores the
+// recording as the rendered video and reports back to Nymphicus, so that the
+// pipeline runs end to end without the real renderer.
+package fakerenderer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"mime/multipart"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/logger"
+	"nymphicus-service/pkg/utils"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	renderPath   = "/v2/send_binary_data"
+	deletePath   = "/v2/delete_video"
+	videosPrefix = "/videos/"
+)
+
+// render is a validated render request.
+type render struct {
+	sessionID string
+	duration  int64
+	file      *multipart.FileHeader
+}
+
+type FakeRenderer struct {
+	config config.FakeRendererConfig
+	logger logger.Logger
+	videos fasthttp.RequestHandler
+}
+
+func New(config config.FakeRendererConfig, logger logger.Logger) *FakeRenderer {
+	fs := &fasthttp.FS{Root: config.StorageDir, PathRewrite: fasthttp.NewPathPrefixStripper(len(videosPrefix) - 1)}
+	return &FakeRenderer{config: config, logger: logger, videos: fs.NewRequestHandler()}
+}
+
+// Run serves the renderer until the listener fails.
+func (r *FakeRenderer) Run() error {
+	if err := os.MkdirAll(r.config.StorageDir, 0o755); err != nil {
+		return err
+	}
+	r.logger.Infof("Fake renderer is listening on PORT: %s, storing videos in %s", r.config.Port, r.config.StorageDir)
+	return fasthttp.ListenAndServe(r.config.Port, r.Handler)
+}
+
+func (r *FakeRenderer) Handler(ctx *fasthttp.RequestCtx) {
+	path := string(ctx.Path())
+	switch {
+	case path == renderPath:
+		r.render(ctx)
+	case path == deletePath:
+		r.delete(ctx)
+	case strings.HasPrefix(path, videosPrefix):
+		r.videos(ctx)
+	default:
+		ctx.Error("Unsupported path", fasthttp.StatusNotFound)
+	}
+}
+
+// render accepts a valid render request and completes it in the background,
+// answering 400 with the first contract violation otherwise.
+func (r *FakeRenderer) render(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		ctx.Error("expected a multipart form: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	job, err := parseRender(form)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	// The form is released with the request; keep the recording until the
+	// render finishes.
+	recording, err := r.saveRecording(job)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	go r.complete(job, recording)
+
+	utils.RespondWithJSON(ctx, fasthttp.StatusAccepted, map[string]string{"sessionId": job.sessionID})
+}
+
+// delete removes the video of the session in the 'sessionId' query parameter.
+func (r *FakeRenderer) delete(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsDelete() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	sessionID := string(ctx.QueryArgs().Peek("sessionId"))
+	if _, err := uuid.Parse(sessionID); err != nil {
+		ctx.Error("invalid 'sessionId' query parameter", fasthttp.StatusBadRequest)
+		return
+	}
+
+	videos, err := filepath.Glob(filepath.Join(r.config.StorageDir, sessionID+".*"))
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+	if len(videos) == 0 {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	for _, video := range videos {
+		if err := os.Remove(video); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// parseRender checks form against the contract built by createRequestBody:
+// one non-empty file, timeLines as ActivityGestureLogs, a session UUID, a
+// positive duration and optional maskedSegments within it.
+func parseRender(form *multipart.Form) (render, error) {
+	var job render
+	files := form.File["file"]
+	if len(files) != 1 {
+		return job, fmt.Errorf("expected one 'file', got %d", len(files))
+	}
+	if files[0].Size == 0 {
+		return job, errors.New("'file' is empty")
+	}
+	job.file = files[0]
+
+	sessionID, err := formValue(form, "sessionId")
+	if err != nil {
+		return job, err
+	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return job, fmt.Errorf("'sessionId' is not a UUID: %v", err)
+	}
+	job.sessionID = sessionID
+
+	duration, err := formValue(form, "duration")
+	if err != nil {
+		return job, err
+	}
+	if job.duration, err = strconv.ParseInt(duration, 10, 64); err != nil || job.duration <= 0 {
+		return job, fmt.Errorf("'duration' is not a positive integer: %q", duration)
+	}
+
+	timeLines, err := formValue(form, "timeLines")
+	if err != nil {
+		return job, err
+	}
+	var logs src.ActivityGestureLogs
+	if err := json.Unmarshal([]byte(timeLines), &logs); err != nil {
+		return job, fmt.Errorf("invalid 'timeLines': %v", err)
+	}
+
+	if _, ok := form.Value["maskedSegments"]; ok {
+		masks, err := formValue(form, "maskedSegments")
+		if err != nil {
+			return job, err
+		}
+		var segments []models.MaskedSegment
+		if err := json.Unmarshal([]byte(masks), &segments); err != nil {
+			return job, fmt.Errorf("invalid 'maskedSegments': %v", err)
+		}
+		if len(segments) == 0 {
+			return job, errors.New("'maskedSegments' is sent only when there are masks")
+		}
+		for i, segment := range segments {
+			switch segment.Mode {
+			case models.MaskDrop, models.MaskBlur, models.MaskStripText:
+			default:
+				return job, fmt.Errorf("masked segment %d: unsupported mode %q", i, segment.Mode)
+			}
+			if segment.Start < 0 || segment.End < segment.Start || segment.End > job.duration {
+				return job, fmt.Errorf("masked segment %d: [%d, %d] is outside [0, %d]", i, segment.Start, segment.End, job.duration)
+			}
+		}
+	}
+	return job, nil
+}
+
+func formValue(form *multipart.Form, name string) (string, error) {
+	values := form.Value[name]
+	if len(values) != 1 || values[0] == "" {
+		return "", fmt.Errorf("expected one non-empty '%s'", name)
+	}
+	return values[0], nil
+}
+
+// saveRecording copies the uploaded recording to a temporary file of
+// StorageDir.
+func (r *FakeRenderer) saveRecording(job render) (string, error) {
+	file, err := job.file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	recording, err := os.CreateTemp(r.config.StorageDir, job.sessionID+"-*.part")
+	if err != nil {
+		return "", err
+	}
+	defer recording.Close()
+	if _, err := recording.ReadFrom(file); err != nil {
+		os.Remove(recording.Name())
+		return "", err
+	}
+	return recording.Name(), nil
+}
+
+// complete waits for the simulated render, then publishes the recording as
+// the video of the session, or drops it on a simulated failure, and reports
+// the outcome.
+func (r *FakeRenderer) complete(job render, recording string) {
+	time.Sleep(r.latency())
+
+	completion := models.RenderCompletion{SessionID: job.sessionID}
+	if rand.Float64() < r.config.FailureRate {
+		os.Remove(recording)
+		completion.Error = "simulated render failure"
+	} else {
+		name := job.sessionID + videoExtension(job.file.Filename)
+		if err := os.Rename(recording, filepath.Join(r.config.StorageDir, name)); err != nil {
+			os.Remove(recording)
+			completion.Error = err.Error()
+		} else {
+			completion.VideoURL = strings.TrimSuffix(r.config.BaseURL, "/") + "/" + name
+		}
+	}
+
+	if err := r.callback(completion); err != nil {
+		r.logger.Errorf("Callback for session %s: %v", job.sessionID, err)
+		return
+	}
+	r.logger.Infof("Rendered session %s: %+v", job.sessionID, completion)
+}
+
+func (r *FakeRenderer) latency() time.Duration {
+	latency := r.config.MinLatency
+	if spread := r.config.MaxLatency - r.config.MinLatency; spread > 0 {
+		latency += time.Duration(rand.Int63n(int64(spread)))
+	}
+	return latency * time.Millisecond
+}
+
+// callback posts completion to CallbackURL, when one is configured.
+func (r *FakeRenderer) callback(completion models.RenderCompletion) error {
+	if r.config.CallbackURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(completion)
+	if err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	req.Header.Set("Authorization", "Bearer "+r.config.CallbackToken)
+	req.SetRequestURI(r.config.CallbackURL)
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	if err := fasthttp.DoTimeout(req, resp, 10*time.Second); err != nil {
+		return err
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("callback failed with status %d: %s", resp.StatusCode(), resp.Body())
+	}
+	return nil
+}
+
+func videoExtension(filename string) string {
+	if ext := filepath.Ext(filename); ext != "" {
+		return ext
+	}
+	return ".mp4"
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// AuditRecord is one entry of the append-only audit log. Hash covers every
+// other field, including the hash of the previous record, so that editing or
+// removing a record breaks the chain from that point on.
+type AuditRecord struct {
+	Sequence     int64             `json:"sequence"`
+	Actor        string            `json:"actor"`
+	Action       string            `json:"action"`
+	Target       string            `json:"target"`
+	Details      map[string]string `json:"details"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	PreviousHash string            `json:"previousHash"`
+	Hash         string            `json:"hash"`
+}
+
+// ComputeHash returns the HMAC-SHA256 of the record without its Hash field
+// under key, or its plain SHA-256 when key is empty.
+func (r AuditRecord) ComputeHash(key []byte) string {
+	r.Hash = ""
+	r.CreatedAt = r.CreatedAt.UTC()
+	data, _ := json.Marshal(r)
+	if len(key) == 0 {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
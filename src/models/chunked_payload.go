@@ -0,0 +1,17 @@
+package models
+
+const (
+	// ChunkEncodingGzip chunks hold the gzipped JSON of Activities and Events.
+	ChunkEncodingGzip = "gzip"
+	// ChunkEncodingSealed chunks hold the BSON of Encrypted.Activities and
+	// Encrypted.Events as sealed.
+	ChunkEncodingSealed = "sealed"
+)
+
+// ChunkedPayload stands in for the activities and events of a session too
+// large for one Mongo document. They are stored in Count chunk documents of Size bytes in total.
+type ChunkedPayload struct {
+	Count    int
+	Size     int64
+	Encoding string
+}
@@ -1,6 +1,12 @@
 package models
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Device struct {
+	AppVersion       string  `json:"appVersion"`
 	BatteryLevel     float64 `json:"batteryLevel"`
 	Brand            string  `json:"brand"`
 	CurrentNetwork   string  `json:"currentNetwork"`
@@ -16,3 +22,22 @@ type Device struct {
 	TotalRAM         string  `json:"totalRAM"`
 	TotalStorage     string  `json:"totalStorage"`
 }
+
+// ScreenSize parses ScreenResolution, written as "1080x2400", into width and height in pixels.
+func (d Device) ScreenSize() (float64, float64, bool) {
+	parts := strings.FieldsFunc(strings.ToLower(d.ScreenResolution), func(r rune) bool {
+		return r == 'x' || r == '*' || r == ',' || r == ' '
+	})
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	width, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || width <= 0 {
+		return 0, 0, false
+	}
+	height, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
@@ -0,0 +1,16 @@
+package models
+
+import "nymphicus-service/pkg/envelope"
+
+// EncryptedPayload holds the Activities, Device, Events, Signals and Masks of
+// a session sealed with its own data key. Only the device fields sessions are
+// queried by stay in Session.Device, with the install ID replaced by its blind
+// index, and only the type of each signal stays in Session.Signals.
+type EncryptedPayload struct {
+	DataKey    envelope.WrappedKey
+	Activities []byte
+	Device     []byte
+	Events     []byte
+	Signals    []byte
+	Masks      []byte
+}
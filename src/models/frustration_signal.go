@@ -0,0 +1,19 @@
+package models
+
+// FrustrationSignal marks a span of a session where the user likely struggled.
+type FrustrationSignal struct {
+	Type        string `json:"type"`
+	Activity    string `json:"activity"`
+	StartTime   int64  `json:"startTime"`
+	EndTime     int64  `json:"endTime"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+}
+
+// ActivitySignalCount is the number of signals of one type raised on an activity.
+type ActivitySignalCount struct {
+	Activity string `json:"activity" bson:"activity"`
+	Type     string `json:"type" bson:"type"`
+	Count    int    `json:"count" bson:"count"`
+	Sessions int    `json:"sessions" bson:"sessions"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// Funnel is the conversion of sessions through an ordered list of activities.
+type Funnel struct {
+	Sessions int          `json:"sessions"`
+	Steps    []FunnelStep `json:"steps"`
+}
+
+// FunnelStep reports how many sessions reached an activity after the previous
+// steps. Conversion and DropOff are relative to the previous step, or to all
+// sessions for the first one.
+type FunnelStep struct {
+	Activity          string   `json:"activity"`
+	MaxGap            int64    `json:"maxGap,omitempty"`
+	Sessions          int      `json:"sessions"`
+	Conversion        float64  `json:"conversion"`
+	OverallConversion float64  `json:"overallConversion"`
+	DropOff           int      `json:"dropOff"`
+	MedianTime        int64    `json:"medianTime"`
+	ExampleSessionIDs []string `json:"exampleSessionIds"`
+	DropOffSessionIDs []string `json:"dropOffSessionIds"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "nymphicus-service/src"
+
+// GestureEvent is the semantic classification of a single src.Gesture.
+type GestureEvent struct {
+	Type          string    `json:"type"`
+	Activity      string    `json:"activity"`
+	ActivityIndex int       `json:"activityIndex"`
+	GestureIndex  int       `json:"gestureIndex"`
+	StartTime     int64     `json:"startTime"`
+	EndTime       int64     `json:"endTime"`
+	Start         src.Point `json:"start"`
+	End           src.Point `json:"end"`
+	Direction     string    `json:"direction,omitempty"`
+	Velocity      float64   `json:"velocity,omitempty"`
+	Scale         float64   `json:"scale,omitempty"`
+	Description   string    `json:"description"`
+}
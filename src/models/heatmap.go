@@ -0,0 +1,15 @@
+package models
+
+// Heatmap is a density grid of taps on one activity. Cells is indexed
+// [row][column]; with Resolution "normalized" the grid spans each device's
+// full screen, otherwise it spans the given resolution in pixels.
+type Heatmap struct {
+	Activity   string  `json:"activity"`
+	Resolution string  `json:"resolution"`
+	Columns    int     `json:"columns"`
+	Rows       int     `json:"rows"`
+	Sessions   int     `json:"sessions"`
+	Taps       int     `json:"taps"`
+	Max        int     `json:"max"`
+	Cells      [][]int `json:"cells"`
+}
@@ -0,0 +1,17 @@
+package models
+
+const (
+	MaskDrop      = "drop"
+	MaskBlur      = "blur"
+	MaskStripText = "strip-text"
+)
+
+// MaskedSegment is an activity visit hidden by a masking rule, in milliseconds
+// from the recording start, so the renderer can blur it in the video.
+type MaskedSegment struct {
+	Activity      string `json:"activity"`
+	ActivityIndex int    `json:"activityIndex"`
+	Mode          string `json:"mode"`
+	Start         int64  `json:"start"`
+	End           int64  `json:"end"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// PrivacyPolicy records how the device data of a session was reduced at ingest.
+type PrivacyPolicy struct {
+	InstallID string   `json:"installID"`
+	Dropped   []string `json:"dropped"`
+	Coarsened []string `json:"coarsened"`
+}
+
+const (
+	InstallIDRaw           = "raw"
+	InstallIDPseudonymized = "hmac-sha256"
+)
@@ -0,0 +1,9 @@
+package models
+
+// RenderCompletion is what the renderer reports once the video of a session
+// is rendered: its URL, or the reason rendering failed.
+type RenderCompletion struct {
+	SessionID string `json:"sessionId"`
+	VideoURL  string `json:"videoUrl,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
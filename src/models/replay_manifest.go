@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ReplayManifestVersion is bumped on every incompatible change of ReplayManifest.
+const ReplayManifestVersion = 1
+
+// ReplayManifest is everything a player needs to replay a session.
+type ReplayManifest struct {
+	Version   int                 `json:"version"`
+	SessionID string              `json:"sessionId"`
+	Status    string              `json:"status"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Duration  int64               `json:"duration"`
+	Sources   []MediaSource       `json:"sources"`
+	Tracks    []TextTrack         `json:"tracks"`
+	Chapters  []Chapter           `json:"chapters"`
+	Timeline  []TimelineEntry     `json:"timeline"`
+	Signals   []FrustrationSignal `json:"signals"`
+	Device    Device              `json:"device"`
+}
+
+type MediaSource struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mimeType"`
+}
+
+// TextTrack is a subtitle track relative to the API root; callers append
+// their access key like for any other session resource.
+type TextTrack struct {
+	URL      string `json:"url"`
+	Kind     string `json:"kind"`
+	Format   string `json:"format"`
+	MimeType string `json:"mimeType"`
+}
+
+// Chapter marks one activity visit on the video timeline, in milliseconds.
+type Chapter struct {
+	Title string `json:"title"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+}
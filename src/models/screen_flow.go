@@ -0,0 +1,28 @@
+package models
+
+// ScreenFlow is the navigation graph of a project, shaped for a Sankey chart.
+// Links from ScreenFlowEntry and to ScreenFlowExit carry entry and exit counts.
+type ScreenFlow struct {
+	Sessions int          `json:"sessions"`
+	Nodes    []ScreenNode `json:"nodes"`
+	Links    []ScreenLink `json:"links"`
+}
+
+const (
+	ScreenFlowEntry = "(entry)"
+	ScreenFlowExit  = "(exit)"
+)
+
+type ScreenNode struct {
+	Name               string `json:"name"`
+	Visits             int    `json:"visits"`
+	Entries            int    `json:"entries"`
+	Exits              int    `json:"exits"`
+	MedianTimeOnScreen int64  `json:"medianTimeOnScreen"`
+}
+
+type ScreenLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
@@ -6,12 +6,21 @@ import (
 )
 
 type Session struct {
-	ID         string                  `json:"id"`
-	Activities src.ActivityGestureLogs `json:"activities"`
-	Device     Device                  `json:"device"`
-	VideoUrl   *string                 `json:"videoUrl"`
-	Status     string                  `json:"status"`
-	CreatedAt  time.Time               `json:"createdAt"`
-	Key        string                  `json:"key"`
-	Duration   int64                   `json:"duration"`
+	ID          string                  `json:"id"`
+	Activities  src.ActivityGestureLogs `json:"activities"`
+	Device      Device                  `json:"device"`
+	VideoUrl    *string                 `json:"videoUrl"`
+	Status      string                  `json:"status"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	Key         string                  `json:"key"`
+	Duration    int64                   `json:"duration"`
+	Events      []GestureEvent          `json:"events"`
+	Signals     []FrustrationSignal     `json:"signals"`
+	SignalCount int                     `json:"signalCount"`
+	Privacy     *PrivacyPolicy          `json:"privacy,omitempty"`
+	Masks       []MaskedSegment         `json:"masks,omitempty"`
+	LegalHold   bool                    `json:"legalHold"`
+	ExpiredAt   *time.Time              `json:"expiredAt,omitempty"`
+	Encrypted   *EncryptedPayload       `json:"-"`
+	Chunks      *ChunkedPayload         `json:"-"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "nymphicus-service/src"
+
+const (
+	TimelineActivity = "activity"
+	TimelineGesture  = "gesture"
+)
+
+// TimelineEntry is an activity visit or a gesture placed on the video
+// timeline, in milliseconds from the start of the recording.
+type TimelineEntry struct {
+	Kind     string     `json:"kind"`
+	Start    int64      `json:"start"`
+	End      int64      `json:"end"`
+	Activity string     `json:"activity"`
+	Gesture  string     `json:"gesture,omitempty"`
+	Position *src.Point `json:"position,omitempty"`
+	Label    string     `json:"label"`
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const accessKeyBytes = 24
+
+// AccessKey describes an access key as stored in Redis, under the key itself.
+type AccessKey struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AccessKeyRepository interface {
+	Create(name string) (string, error)
+	Revoke(key string) (bool, error)
+	Exists(key string) (bool, error)
+}
+
+type accessKeyRepository struct {
+	redisClient *redis.Client
+}
+
+func NewAccessKeyRepository(redisClient *redis.Client) AccessKeyRepository {
+	return &accessKeyRepository{redisClient: redisClient}
+}
+
+// Create generates a random access key for the project name.
+func (r *accessKeyRepository) Create(name string) (string, error) {
+	key, err := newAccessKey()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(AccessKey{Name: name, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := r.redisClient.SetNX(ctx, key, value, 0).Result()
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		// 192 random bits never collide in practice, but never overwrite a key.
+		return "", errors.New("generated access key already exists")
+	}
+	return key, nil
+}
+
+// Revoke deletes key and reports whether it existed.
+func (r *accessKeyRepository) Revoke(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := r.redisClient.Del(ctx, key).Result()
+	return deleted == 1, err
+}
+
+func (r *accessKeyRepository) Exists(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	exists, err := r.redisClient.Exists(ctx, key).Result()
+	return exists == 1, err
+}
+
+func newAccessKey() (string, error) {
+	raw := make([]byte, accessKeyBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
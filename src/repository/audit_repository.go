@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"nymphicus-service/src/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	auditAppendRetries = 5
+	defaultAuditLimit  = 100
+	maxAuditLimit      = 1000
+)
+
+type AuditRepository interface {
+	Append(record models.AuditRecord) (models.AuditRecord, error)
+	FindRecords(filter AuditFilter) ([]models.AuditRecord, error)
+	IterateRecords(fn func(models.AuditRecord) error) error
+}
+
+// AuditFilter narrows the audit log. Zero values are ignored. Records come in
+// sequence order, starting after AfterSequence.
+type AuditFilter struct {
+	Actor         string
+	Action        string
+	Target        string
+	From          time.Time
+	To            time.Time
+	AfterSequence int64
+	Limit         int64
+}
+
+func (f AuditFilter) query() bson.M {
+	query := bson.M{}
+	if f.Actor != "" {
+		query["actor"] = f.Actor
+	}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if f.Target != "" {
+		query["target"] = f.Target
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		createdAt := bson.M{}
+		if !f.From.IsZero() {
+			createdAt["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			createdAt["$lt"] = f.To
+		}
+		query["createdat"] = createdAt
+	}
+	if f.AfterSequence > 0 {
+		query["sequence"] = bson.M{"$gt": f.AfterSequence}
+	}
+	return query
+}
+
+func (f AuditFilter) matches(record models.AuditRecord) bool {
+	if f.Actor != "" && record.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && record.Action != f.Action {
+		return false
+	}
+	if f.Target != "" && record.Target != f.Target {
+		return false
+	}
+	if !f.From.IsZero() && record.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !record.CreatedAt.Before(f.To) {
+		return false
+	}
+	return record.Sequence > f.AfterSequence
+}
+
+func (f AuditFilter) limit() int64 {
+	if f.Limit <= 0 {
+		return defaultAuditLimit
+	}
+	if f.Limit > maxAuditLimit {
+		return maxAuditLimit
+	}
+	return f.Limit
+}
+
+type auditRepository struct {
+	database *mongo.Database
+	chainKey []byte
+	indexMu  sync.Mutex
+	indexed  bool
+}
+
+// NewAuditRepository keeps the audit log in the audit collection, chained
+// with chainKey.
+func NewAuditRepository(database *mongo.Database, chainKey []byte) AuditRepository {
+	return &auditRepository{database: database, chainKey: chainKey}
+}
+
+// Append chains record to the last one and stores it. Concurrent appends race
+// for the next sequence number; the unique index makes the loser retry. The
+// index belongs to migration 2, but appends must not fork the chain while it
+// is pending, so the first append of the process creates it as well.
+func (c *auditRepository) Append(record models.AuditRecord) (models.AuditRecord, error) {
+	collection := c.database.Collection("audit")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.ensureSequenceIndex(ctx, collection); err != nil {
+		return record, err
+	}
+
+	// Mongo keeps dates to the millisecond; hash what will be read back.
+	record.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		var last models.AuditRecord
+		err := collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})).Decode(&last)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			record.Sequence, record.PreviousHash = 1, ""
+		case err != nil:
+			return record, err
+		default:
+			record.Sequence, record.PreviousHash = last.Sequence+1, last.Hash
+		}
+		record.Hash = record.ComputeHash(c.chainKey)
+
+		_, err = collection.InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		return record, err
+	}
+	return record, errors.New("failed to append audit record: too much contention")
+}
+
+// ensureSequenceIndex creates the unique sequence index until it succeeds once.
+func (c *auditRepository) ensureSequenceIndex(ctx context.Context, collection *mongo.Collection) error {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if c.indexed {
+		return nil
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "sequence", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	c.indexed = err == nil
+	return err
+}
+
+func (c *auditRepository) FindRecords(filter AuditFilter) ([]models.AuditRecord, error) {
+	collection := c.database.Collection("audit")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(filter.limit())
+	cursor, err := collection.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]models.AuditRecord, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// IterateRecords calls fn for every record in sequence order.
+func (c *auditRepository) IterateRecords(fn func(models.AuditRecord) error) error {
+	collection := c.database.Collection("audit")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record models.AuditRecord
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var accessKeysBucket = []byte("access_keys")
+
+type boltAccessKeyRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltAccessKeyRepository keeps access keys in the embedded database
+// instead of Redis.
+func NewBoltAccessKeyRepository(db *bolt.DB) (AccessKeyRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(accessKeysBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltAccessKeyRepository{db: db}, nil
+}
+
+func (r *boltAccessKeyRepository) Create(name string) (string, error) {
+	key, err := newAccessKey()
+	if err != nil {
+		return "", err
+	}
+	value, err := json.Marshal(AccessKey{Name: name, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(accessKeysBucket)
+		if bucket.Get([]byte(key)) != nil {
+			return errors.New("generated access key already exists")
+		}
+		return bucket.Put([]byte(key), value)
+	})
+	return key, err
+}
+
+func (r *boltAccessKeyRepository) Revoke(key string) (bool, error) {
+	revoked := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(accessKeysBucket)
+		if bucket.Get([]byte(key)) == nil {
+			return nil
+		}
+		revoked = true
+		return bucket.Delete([]byte(key))
+	})
+	return revoked, err
+}
+
+func (r *boltAccessKeyRepository) Exists(key string) (bool, error) {
+	exists := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(accessKeysBucket).Get([]byte(key)) != nil
+		return nil
+	})
+	return exists, err
+}
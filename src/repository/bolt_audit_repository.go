@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"encoding/binary"
+	"fmt"
+	"nymphicus-service/src/models"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var auditBucket = []byte("audit")
+
+type boltAuditRepository struct {
+	db       *bolt.DB
+	chainKey []byte
+}
+
+// NewBoltAuditRepository keeps the audit log in the embedded database, keyed
+// by sequence number and chained with chainKey.
+func NewBoltAuditRepository(db *bolt.DB, chainKey []byte) (AuditRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(auditBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltAuditRepository{db: db, chainKey: chainKey}, nil
+}
+
+// Append chains record to the last one and stores it. Bolt serializes write
+// transactions, so appends never race.
+func (r *boltAuditRepository) Append(record models.AuditRecord) (models.AuditRecord, error) {
+	record.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(auditBucket)
+		record.Sequence, record.PreviousHash = 1, ""
+		if _, value := bucket.Cursor().Last(); value != nil {
+			last, err := decodeAuditRecord(value)
+			if err != nil {
+				return err
+			}
+			record.Sequence, record.PreviousHash = last.Sequence+1, last.Hash
+		}
+		record.Hash = record.ComputeHash(r.chainKey)
+
+		value, err := bson.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(sequenceKey(record.Sequence), value)
+	})
+	return record, err
+}
+
+func (r *boltAuditRepository) FindRecords(filter AuditFilter) ([]models.AuditRecord, error) {
+	records := make([]models.AuditRecord, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+		for k, value := cursor.Seek(sequenceKey(filter.AfterSequence + 1)); k != nil && int64(len(records)) < filter.limit(); k, value = cursor.Next() {
+			record, err := decodeAuditRecord(value)
+			if err != nil {
+				return err
+			}
+			if filter.matches(record) {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// IterateRecords calls fn for every record in sequence order. The log is read
+// in one transaction; fn must not append to it.
+func (r *boltAuditRepository) IterateRecords(fn func(models.AuditRecord) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(_, value []byte) error {
+			record, err := decodeAuditRecord(value)
+			if err != nil {
+				return err
+			}
+			return fn(record)
+		})
+	})
+}
+
+func sequenceKey(sequence int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(sequence))
+	return key
+}
+
+func decodeAuditRecord(value []byte) (models.AuditRecord, error) {
+	var record models.AuditRecord
+	if err := bson.Unmarshal(append([]byte(nil), value...), &record); err != nil {
+		return record, fmt.Errorf("invalid audit record: %w", err)
+	}
+	return record, nil
+}
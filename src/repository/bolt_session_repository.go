@@ -0,0 +1,396 @@
+package repository
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/src/models"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	sessionsBucket        = []byte("sessions")
+	sessionsCreatedBucket = []byte("sessions_by_created")
+)
+
+// boltIterationBatch is the number of sessions read per transaction while
+// iterating, so that callbacks run outside of it and may write.
+const boltIterationBatch = 100
+
+// errDuplicateSession mirrors the unique index on sessions.id.
+var errDuplicateSession = errors.New("a session with this ID already exists")
+
+type boltSessionRepository struct {
+	sessionCipher
+	db *bolt.DB
+}
+
+// NewBoltSessionRepository stores sessions in an embedded bbolt database,
+// encoded as the same BSON documents Mongo holds. Filters are evaluated in
+// memory, which suits the volumes of single-node deployments.
+func NewBoltSessionRepository(db *bolt.DB, keyring *envelope.Keyring) (SessionRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{sessionsBucket, sessionsCreatedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltSessionRepository{sessionCipher: sessionCipher{keyring: keyring}, db: db}, nil
+}
+
+func (r *boltSessionRepository) SaveActionsToMongo(actions models.Session) error {
+	actions, err := r.seal(actions)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		if sessions.Get([]byte(actions.ID)) != nil {
+			return errDuplicateSession
+		}
+		if err := putSession(sessions, actions); err != nil {
+			return err
+		}
+		return tx.Bucket(sessionsCreatedBucket).Put(createdKey(actions), nil)
+	})
+}
+
+// UpdateSessionStatusToError marks one session of the project of key as
+// failed, like the Mongo implementation does.
+func (r *boltSessionRepository) UpdateSessionStatusToError(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		cursor := tx.Bucket(sessionsCreatedBucket).Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			session, err := getSession(sessions, createdKeyID(k))
+			if err != nil {
+				return err
+			}
+			if session.Key == key {
+				session.Status = enum.Error.String()
+				return putSession(sessions, session)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltSessionRepository) FindSessionByID(id string, key string) (models.Session, error) {
+	var session models.Session
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = getSession(tx.Bucket(sessionsBucket), id)
+		if err == nil && session.Key != key {
+			err = mongo.ErrNoDocuments
+		}
+		return err
+	})
+	if err != nil {
+		return session, err
+	}
+	return session, r.open(&session)
+}
+
+// FindSessions lists sessions without their raw activities, the ones with the
+// most frustration signals first.
+func (r *boltSessionRepository) FindSessions(filter SessionFilter) ([]models.Session, error) {
+	return findSessions(r.iterate, r.sessionCipher, filter)
+}
+
+func (r *boltSessionRepository) CountSignalsByActivity(key string) ([]models.ActivitySignalCount, error) {
+	return countSignals(r.iterate, r.sessionCipher, key)
+}
+
+// IterateSessions calls fn for every session matching filter, oldest first
+// with ties broken by ID. Limit and Skip are ignored.
+func (r *boltSessionRepository) IterateSessions(filter SessionFilter, fn func(models.Session) error) error {
+	filter = r.withBlindIndexes(filter)
+	return r.iterate(filter.matches, func(session models.Session) error {
+		if err := r.open(&session); err != nil {
+			return err
+		}
+		return fn(session)
+	})
+}
+
+// SessionExists reports whether a session with id is stored, in any project.
+func (r *boltSessionRepository) SessionExists(id string) (bool, error) {
+	var exists bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(sessionsBucket).Get([]byte(id)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (r *boltSessionRepository) DeleteSessionsByID(ids []string) (int64, error) {
+	var deleted int64
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		for _, id := range ids {
+			session, err := getSession(sessions, id)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := sessions.Delete([]byte(id)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(sessionsCreatedBucket).Delete(createdKey(session)); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// IterateExpiredSessions calls fn for every session matching criteria,
+// without its raw activities.
+func (r *boltSessionRepository) IterateExpiredSessions(criteria ExpiryCriteria, fn func(models.Session) error) error {
+	return r.iterate(criteria.matches, func(session models.Session) error {
+		withoutPayload(&session)
+		session.Encrypted = nil
+		return fn(session)
+	})
+}
+
+// ExpireSession strips the recorded payload of a session and marks it
+// Expired, unless it is on legal hold. It reports whether the session was expired.
+func (r *boltSessionRepository) ExpireSession(id string) (bool, error) {
+	expired := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		session, err := getSession(sessions, id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil || session.LegalHold || session.Status == enum.Expired.String() {
+			return err
+		}
+
+		now := time.Now()
+		withoutPayload(&session)
+		session.Status = enum.Expired.String()
+		session.ExpiredAt = &now
+		session.VideoUrl = nil
+		session.Signals = nil
+		session.SignalCount = 0
+		session.Device = models.Device{}
+		session.Encrypted = nil
+		session.Chunks = nil
+		expired = true
+		return putSession(sessions, session)
+	})
+	return expired, err
+}
+
+func (r *boltSessionRepository) SetLegalHold(id string, key string, hold bool) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		session, err := getSession(sessions, id)
+		if err != nil {
+			return err
+		}
+		if session.Key != key {
+			return mongo.ErrNoDocuments
+		}
+		session.LegalHold = hold
+		return putSession(sessions, session)
+	})
+}
+
+// CompleteRender records the result of rendering a session still in progress:
+// Complete with videoURL, or Error when videoURL is nil.
+func (r *boltSessionRepository) CompleteRender(id string, videoURL *string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		session, err := getSession(sessions, id)
+		if err != nil {
+			return err
+		}
+		if session.Status != enum.InProgress.String() {
+			return mongo.ErrNoDocuments
+		}
+		completeRender(&session, videoURL)
+		return putSession(sessions, session)
+	})
+}
+
+// RestartRender puts a rendered or failed session of the project of key back
+// in progress, without its video, for it to be rendered again.
+func (r *boltSessionRepository) RestartRender(id string, key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		session, err := getSession(sessions, id)
+		if err != nil {
+			return err
+		}
+		if !restartRender(&session, key) {
+			return mongo.ErrNoDocuments
+		}
+		return putSession(sessions, session)
+	})
+}
+
+// RewrapDataKeys wraps the data key of every session encrypted under an older
+// master key with the active one. The payloads are left untouched.
+func (r *boltSessionRepository) RewrapDataKeys() (int64, error) {
+	if r.keyring == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	var rewrapped int64
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		cursor := sessions.Cursor()
+		for k, value := cursor.First(); k != nil; k, value = cursor.Next() {
+			session, err := decodeSession(value)
+			if err != nil {
+				return err
+			}
+			if session.Encrypted == nil {
+				continue
+			}
+			dataKey, changed, err := r.keyring.Rewrap(session.Encrypted.DataKey)
+			if err != nil {
+				return fmt.Errorf("session %s: %w", session.ID, err)
+			}
+			if !changed {
+				continue
+			}
+			session.Encrypted.DataKey = dataKey
+			if err := putSession(sessions, session); err != nil {
+				return err
+			}
+			rewrapped++
+		}
+		return nil
+	})
+	return rewrapped, err
+}
+
+// iterate walks the sessions in creation order in batches of
+// boltIterationBatch, calling fn on the ones matching outside of any transaction.
+func (r *boltSessionRepository) iterate(match func(models.Session) bool, fn func(models.Session) error) error {
+	var position []byte
+	for {
+		batch := make([]models.Session, 0, boltIterationBatch)
+		err := r.db.View(func(tx *bolt.Tx) error {
+			sessions := tx.Bucket(sessionsBucket)
+			cursor := tx.Bucket(sessionsCreatedBucket).Cursor()
+			k, _ := cursor.First()
+			if position != nil {
+				if k, _ = cursor.Seek(position); k != nil && string(k) == string(position) {
+					k, _ = cursor.Next()
+				}
+			}
+			for ; k != nil && len(batch) < boltIterationBatch; k, _ = cursor.Next() {
+				position = append(position[:0], k...)
+				session, err := getSession(sessions, createdKeyID(k))
+				if err != nil {
+					return err
+				}
+				if match(session) {
+					batch = append(batch, session)
+				}
+			}
+			if k == nil {
+				position = nil
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, session := range batch {
+			if err := fn(session); err != nil {
+				return err
+			}
+		}
+		if position == nil {
+			return nil
+		}
+	}
+}
+
+// createdKey orders sessions by creation time in milliseconds, as Mongo
+// stores it, then by ID.
+func createdKey(session models.Session) []byte {
+	key := make([]byte, 8, 8+len(session.ID))
+	binary.BigEndian.PutUint64(key, uint64(session.CreatedAt.UnixMilli()))
+	return append(key, session.ID...)
+}
+
+func createdKeyID(key []byte) string {
+	return string(key[8:])
+}
+
+func getSession(bucket *bolt.Bucket, id string) (models.Session, error) {
+	value := bucket.Get([]byte(id))
+	if value == nil {
+		return models.Session{}, mongo.ErrNoDocuments
+	}
+	return decodeSession(value)
+}
+
+func putSession(bucket *bolt.Bucket, session models.Session) error {
+	value, err := bson.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(session.ID), value)
+}
+
+// decodeSession decodes a copy of value, which bolt only keeps valid for the
+// transaction.
+func decodeSession(value []byte) (models.Session, error) {
+	var session models.Session
+	err := bson.Unmarshal(append([]byte(nil), value...), &session)
+	return session, err
+}
+
+// withoutPayload drops what the Mongo implementation projects out of listings.
+func withoutPayload(session *models.Session) {
+	session.Activities.Activities = nil
+	session.Events = nil
+	if session.Encrypted != nil {
+		session.Encrypted.Activities = nil
+		session.Encrypted.Events = nil
+	}
+}
+
+// restartRender puts session back in progress when it belongs to key and is
+// done rendering, and reports whether it did.
+func restartRender(session *models.Session, key string) bool {
+	if session.Key != key || (session.Status != enum.Complete.String() && session.Status != enum.Error.String()) {
+		return false
+	}
+	session.Status = enum.InProgress.String()
+	session.VideoUrl = nil
+	return true
+}
+
+// completeRender applies what the Mongo CompleteRender update sets.
+func completeRender(session *models.Session, videoURL *string) {
+	if videoURL == nil {
+		session.Status = enum.Error.String()
+		return
+	}
+	session.Status = enum.Complete.String()
+	session.VideoUrl = videoURL
+}
@@ -0,0 +1,350 @@
+// Package conformance checks that a SessionRepository behaves like the Mongo
+// implementation. Every backend must pass it: the package tests run it against
+// the memory and bolt backends, and against Mongo when
+// NYMPHICUS_TEST_MONGO_URI is set. The storage check command runs it against
+// a live store.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+type check struct {
+	name string
+	run  func(f *fixture) error
+}
+
+// fixture is the data every check runs against: two sessions of a scratch
+// project, oldest first, and one of another project.
+type fixture struct {
+	repo    repository.SessionRepository
+	key     string
+	older   models.Session
+	newer   models.Session
+	foreign models.Session
+}
+
+var checks = []check{
+	{"find by id", checkFindByID},
+	{"find by id is scoped to the project", checkFindByIDScope},
+	{"list orders by signal count", checkListOrder},
+	{"list filters", checkListFilters},
+	{"iterate in creation order and resume", checkIterate},
+	{"count signals by activity", checkCountSignals},
+	{"complete render", checkCompleteRender},
+	{"legal hold blocks expiry", checkLegalHold},
+	{"expire strips the payload", checkExpire},
+	{"delete by id", checkDelete},
+}
+
+// Run saves scratch sessions under random project keys, runs every check in
+// order and deletes the sessions. Checks depend on the ones before them, so a
+// failure may cascade.
+func Run(repo repository.SessionRepository) ([]Result, error) {
+	f := newFixture(repo)
+	for _, session := range []models.Session{f.older, f.newer, f.foreign} {
+		if err := repo.SaveActionsToMongo(session); err != nil {
+			return nil, fmt.Errorf("save %s: %w", session.ID, err)
+		}
+	}
+
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		result := Result{Name: c.name}
+		if err := c.run(f); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	_, err := repo.DeleteSessionsByID([]string{f.older.ID, f.newer.ID, f.foreign.ID})
+	return results, err
+}
+
+func newFixture(repo repository.SessionRepository) *fixture {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	key := "conformance-" + uuid.New().String()
+	session := func(createdAt time.Time, key string, platform string, installID string, signals []models.FrustrationSignal) models.Session {
+		return models.Session{
+			ID: uuid.New().String(),
+			Activities: src.ActivityGestureLogs{Activities: []src.ActivityGesture{{
+				ActivityName: "MainActivity",
+				Gestures: []src.Gesture{{Actions: []src.Action{
+					{Action: src.ActionDown, TargetTime: "100", Coordinates: "10,20"},
+					{Action: src.ActionUp, TargetTime: "180", Coordinates: "10,20"},
+				}}},
+			}}},
+			Device:      models.Device{Platform: platform, InstallID: installID, AppVersion: "1.0.0"},
+			Status:      enum.InProgress.String(),
+			CreatedAt:   createdAt,
+			Key:         key,
+			Duration:    1000,
+			Signals:     signals,
+			SignalCount: len(signals),
+		}
+	}
+	rageTaps := []models.FrustrationSignal{
+		{Type: enum.RageTap.String(), Activity: "MainActivity", StartTime: 100, EndTime: 500, Count: 4},
+		{Type: enum.RageTap.String(), Activity: "MainActivity", StartTime: 700, EndTime: 900, Count: 3},
+	}
+	return &fixture{
+		repo:    repo,
+		key:     key,
+		older:   session(now.Add(-2*time.Hour), key, "android", "install-older", nil),
+		newer:   session(now.Add(-time.Hour), key, "ios", "install-newer", rageTaps),
+		foreign: session(now.Add(-time.Hour), "conformance-"+uuid.New().String(), "android", "install-older", nil),
+	}
+}
+
+func checkFindByID(f *fixture) error {
+	session, err := f.repo.FindSessionByID(f.older.ID, f.key)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(session.Activities, f.older.Activities) {
+		return errors.New("activities differ from the saved ones")
+	}
+	if session.Device != f.older.Device {
+		return errors.New("device differs from the saved one")
+	}
+	if !session.CreatedAt.Equal(f.older.CreatedAt) {
+		return fmt.Errorf("createdAt is %s, saved %s", session.CreatedAt, f.older.CreatedAt)
+	}
+	return nil
+}
+
+func checkFindByIDScope(f *fixture) error {
+	if _, err := f.repo.FindSessionByID(f.older.ID, f.foreign.Key); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments for another project, got %v", err)
+	}
+	if _, err := f.repo.FindSessionByID(uuid.New().String(), f.key); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments for an unknown ID, got %v", err)
+	}
+	return nil
+}
+
+func checkListOrder(f *fixture) error {
+	sessions, err := f.repo.FindSessions(repository.SessionFilter{Key: f.key})
+	if err != nil {
+		return err
+	}
+	if err := expectIDs(sessions, f.newer.ID, f.older.ID); err != nil {
+		return err
+	}
+	if len(sessions[0].Activities.Activities) > 0 || len(sessions[0].Events) > 0 {
+		return errors.New("listed sessions should not carry their activities or events")
+	}
+
+	sessions, err = f.repo.FindSessions(repository.SessionFilter{Key: f.key, Skip: 1, Limit: 1})
+	if err != nil {
+		return err
+	}
+	return expectIDs(sessions, f.older.ID)
+}
+
+func checkListFilters(f *fixture) error {
+	filters := []struct {
+		filter   repository.SessionFilter
+		expected []string
+	}{
+		{repository.SessionFilter{Key: f.key, Platform: "android"}, []string{f.older.ID}},
+		{repository.SessionFilter{Key: f.key, Signal: enum.RageTap.String()}, []string{f.newer.ID}},
+		{repository.SessionFilter{Key: f.key, InstallIDs: []string{"install-newer"}}, []string{f.newer.ID}},
+		{repository.SessionFilter{Key: f.key, From: f.newer.CreatedAt}, []string{f.newer.ID}},
+		{repository.SessionFilter{Key: f.key, To: f.newer.CreatedAt}, []string{f.older.ID}},
+		{repository.SessionFilter{Key: f.key, Status: enum.Complete.String()}, nil},
+	}
+	for i, test := range filters {
+		sessions, err := f.repo.FindSessions(test.filter)
+		if err != nil {
+			return err
+		}
+		if err := expectIDs(sessions, test.expected...); err != nil {
+			return fmt.Errorf("filter %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func checkIterate(f *fixture) error {
+	var sessions []models.Session
+	collect := func(session models.Session) error {
+		sessions = append(sessions, session)
+		return nil
+	}
+	if err := f.repo.IterateSessions(repository.SessionFilter{Key: f.key}, collect); err != nil {
+		return err
+	}
+	if err := expectIDs(sessions, f.older.ID, f.newer.ID); err != nil {
+		return err
+	}
+	if len(sessions[0].Activities.Activities) == 0 {
+		return errors.New("iterated sessions should carry their activities")
+	}
+
+	sessions = nil
+	after := repository.SessionCursor{CreatedAt: f.older.CreatedAt, ID: f.older.ID}
+	if err := f.repo.IterateSessions(repository.SessionFilter{Key: f.key, After: &after}, collect); err != nil {
+		return err
+	}
+	return expectIDs(sessions, f.newer.ID)
+}
+
+func checkCountSignals(f *fixture) error {
+	counts, err := f.repo.CountSignalsByActivity(f.key)
+	if err != nil {
+		return err
+	}
+	expected := []models.ActivitySignalCount{{Activity: "MainActivity", Type: enum.RageTap.String(), Count: 2, Sessions: 1}}
+	if !reflect.DeepEqual(counts, expected) {
+		return fmt.Errorf("expected %+v, got %+v", expected, counts)
+	}
+	return nil
+}
+
+func checkCompleteRender(f *fixture) error {
+	videoURL := "https://videos.example.com/" + f.newer.ID + ".mp4"
+	if err := f.repo.CompleteRender(f.newer.ID, &videoURL); err != nil {
+		return err
+	}
+	session, err := f.repo.FindSessionByID(f.newer.ID, f.key)
+	if err != nil {
+		return err
+	}
+	if session.Status != enum.Complete.String() || session.VideoUrl == nil || *session.VideoUrl != videoURL {
+		return fmt.Errorf("status is %q, videoUrl %v", session.Status, session.VideoUrl)
+	}
+	if err := f.repo.CompleteRender(f.newer.ID, nil); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments for a rendered session, got %v", err)
+	}
+
+	if err := f.repo.RestartRender(f.newer.ID, f.foreign.Key); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments restarting from another project, got %v", err)
+	}
+	if err := f.repo.RestartRender(f.newer.ID, f.key); err != nil {
+		return err
+	}
+	if err := f.repo.RestartRender(f.newer.ID, f.key); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments restarting a session in progress, got %v", err)
+	}
+	session, err = f.repo.FindSessionByID(f.newer.ID, f.key)
+	if err != nil {
+		return err
+	}
+	if session.Status != enum.InProgress.String() || session.VideoUrl != nil {
+		return fmt.Errorf("after restart status is %q, videoUrl %v", session.Status, session.VideoUrl)
+	}
+	return f.repo.CompleteRender(f.newer.ID, &videoURL)
+}
+
+func checkLegalHold(f *fixture) error {
+	if err := f.repo.SetLegalHold(f.newer.ID, f.foreign.Key, true); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments for another project, got %v", err)
+	}
+	if err := f.repo.SetLegalHold(f.newer.ID, f.key, true); err != nil {
+		return err
+	}
+	expired, err := f.repo.ExpireSession(f.newer.ID)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return errors.New("a session on legal hold was expired")
+	}
+
+	var seen []models.Session
+	criteria := repository.ExpiryCriteria{Key: f.key, CreatedBefore: time.Now().Add(time.Hour)}
+	err = f.repo.IterateExpiredSessions(criteria, func(session models.Session) error {
+		seen = append(seen, session)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := expectIDs(seen, f.older.ID, f.newer.ID); err != nil {
+		return err
+	}
+	if !seen[1].LegalHold {
+		return errors.New("held session not reported as held")
+	}
+	return f.repo.SetLegalHold(f.newer.ID, f.key, false)
+}
+
+func checkExpire(f *fixture) error {
+	expired, err := f.repo.ExpireSession(f.older.ID)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return errors.New("session was not expired")
+	}
+
+	session, err := f.repo.FindSessionByID(f.older.ID, f.key)
+	if err != nil {
+		return err
+	}
+	if session.Status != enum.Expired.String() || session.ExpiredAt == nil {
+		return fmt.Errorf("status is %q, expiredAt %v", session.Status, session.ExpiredAt)
+	}
+	if len(session.Activities.Activities) > 0 || session.Device.InstallID != "" {
+		return errors.New("expired session still carries its payload")
+	}
+
+	criteria := repository.ExpiryCriteria{Key: f.key, CreatedBefore: time.Now().Add(time.Hour)}
+	return f.repo.IterateExpiredSessions(criteria, func(session models.Session) error {
+		if session.ID == f.older.ID {
+			return errors.New("expired session is still selected for expiry")
+		}
+		return nil
+	})
+}
+
+func checkDelete(f *fixture) error {
+	if exists, err := f.repo.SessionExists(f.foreign.ID); err != nil || !exists {
+		return fmt.Errorf("expected %s to exist before delete, got %v, %v", f.foreign.ID, exists, err)
+	}
+	deleted, err := f.repo.DeleteSessionsByID([]string{f.older.ID, f.newer.ID, f.foreign.ID, uuid.New().String()})
+	if err != nil {
+		return err
+	}
+	if deleted != 3 {
+		return fmt.Errorf("deleted %d sessions, expected 3", deleted)
+	}
+	if _, err := f.repo.FindSessionByID(f.newer.ID, f.key); !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("expected ErrNoDocuments after delete, got %v", err)
+	}
+	if exists, err := f.repo.SessionExists(f.foreign.ID); err != nil || exists {
+		return fmt.Errorf("expected %s to be gone after delete, got %v, %v", f.foreign.ID, exists, err)
+	}
+	return nil
+}
+
+func expectIDs(sessions []models.Session, expected ...string) error {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if len(expected) == 0 && len(ids) == 0 {
+		return nil
+	}
+	if !reflect.DeepEqual(ids, expected) {
+		return fmt.Errorf("expected sessions %v, got %v", expected, ids)
+	}
+	return nil
+}
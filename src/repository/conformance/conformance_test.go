@@ -0,0 +1,91 @@
+package conformance
+
+import (
+	"context"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/src/repository"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoURIEnv points the tests at a MongoDB server they may create and drop
+// scratch databases on. Without it the Mongo backend is skipped.
+const mongoURIEnv = "NYMPHICUS_TEST_MONGO_URI"
+
+func TestMemory(t *testing.T) {
+	run(t, func(t *testing.T, keyring *envelope.Keyring) repository.SessionRepository {
+		return repository.NewMemorySessionRepository(keyring)
+	})
+}
+
+func TestBolt(t *testing.T) {
+	run(t, func(t *testing.T, keyring *envelope.Keyring) repository.SessionRepository {
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "nymphicus.db"), 0o600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		repo, err := repository.NewBoltSessionRepository(db, keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestMongo(t *testing.T) {
+	uri := os.Getenv(mongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", mongoURIEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	run(t, func(t *testing.T, keyring *envelope.Keyring) repository.SessionRepository {
+		database := client.Database("nymphicus_conformance_" + uuid.New().String()[:8])
+		t.Cleanup(func() { database.Drop(context.Background()) })
+		return repository.NewSessionRepository(database, keyring)
+	})
+}
+
+// run checks the repository built by open, in plaintext and with encryption.
+func run(t *testing.T, open func(t *testing.T, keyring *envelope.Keyring) repository.SessionRepository) {
+	t.Run("plaintext", func(t *testing.T) {
+		expectConformance(t, open(t, nil))
+	})
+	t.Run("encrypted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keyfile.json")
+		if err := envelope.AddKey(path, "test"); err != nil {
+			t.Fatal(err)
+		}
+		keyring, err := envelope.LoadKeyring(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectConformance(t, open(t, keyring))
+	})
+}
+
+func expectConformance(t *testing.T, repo repository.SessionRepository) {
+	results, err := Run(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("%s: %s", result.Name, result.Error)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type memoryAccessKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[string]AccessKey
+}
+
+// NewMemoryAccessKeyRepository keeps access keys in process memory instead of
+// Redis.
+func NewMemoryAccessKeyRepository() AccessKeyRepository {
+	return &memoryAccessKeyRepository{keys: make(map[string]AccessKey)}
+}
+
+func (r *memoryAccessKeyRepository) Create(name string) (string, error) {
+	key, err := newAccessKey()
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return "", errors.New("generated access key already exists")
+	}
+	r.keys[key] = AccessKey{Name: name, CreatedAt: time.Now().UTC()}
+	return key, nil
+}
+
+func (r *memoryAccessKeyRepository) Revoke(key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.keys[key]
+	delete(r.keys, key)
+	return ok, nil
+}
+
+func (r *memoryAccessKeyRepository) Exists(key string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.keys[key]
+	return ok, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"nymphicus-service/src/models"
+	"sync"
+	"time"
+)
+
+type memoryAuditRepository struct {
+	mu       sync.RWMutex
+	chainKey []byte
+	records  []models.AuditRecord
+}
+
+// NewMemoryAuditRepository keeps the audit log in process memory, in
+// sequence order, chained with chainKey.
+func NewMemoryAuditRepository(chainKey []byte) AuditRepository {
+	return &memoryAuditRepository{chainKey: chainKey}
+}
+
+func (r *memoryAuditRepository) Append(record models.AuditRecord) (models.AuditRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	record.Sequence, record.PreviousHash = 1, ""
+	if len(r.records) > 0 {
+		last := r.records[len(r.records)-1]
+		record.Sequence, record.PreviousHash = last.Sequence+1, last.Hash
+	}
+	record.Hash = record.ComputeHash(r.chainKey)
+	r.records = append(r.records, record)
+	return record, nil
+}
+
+func (r *memoryAuditRepository) FindRecords(filter AuditFilter) ([]models.AuditRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]models.AuditRecord, 0)
+	for _, record := range r.records {
+		if int64(len(records)) >= filter.limit() {
+			break
+		}
+		if record.Sequence > filter.AfterSequence && filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// IterateRecords calls fn for every record in sequence order, on a snapshot
+// of the log.
+func (r *memoryAuditRepository) IterateRecords(fn func(models.AuditRecord) error) error {
+	r.mu.RLock()
+	records := append([]models.AuditRecord(nil), r.records...)
+	r.mu.RUnlock()
+
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
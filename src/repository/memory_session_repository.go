@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/src/models"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memorySessionRepository struct {
+	sessionCipher
+	mu       sync.RWMutex
+	sessions map[string][]byte
+}
+
+// NewMemorySessionRepository keeps sessions in process memory, encoded as the
+// BSON documents Mongo holds so that callers never share state with the
+// store. Everything is lost on exit; it is meant for dev mode and tests.
+func NewMemorySessionRepository(keyring *envelope.Keyring) SessionRepository {
+	return &memorySessionRepository{
+		sessionCipher: sessionCipher{keyring: keyring},
+		sessions:      make(map[string][]byte),
+	}
+}
+
+func (r *memorySessionRepository) SaveActionsToMongo(actions models.Session) error {
+	actions, err := r.seal(actions)
+	if err != nil {
+		return err
+	}
+	value, err := bson.Marshal(actions)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[actions.ID]; ok {
+		return errDuplicateSession
+	}
+	r.sessions[actions.ID] = value
+	return nil
+}
+
+// UpdateSessionStatusToError marks one session of the project of key as
+// failed, like the Mongo implementation does.
+func (r *memorySessionRepository) UpdateSessionStatusToError(key string) error {
+	return r.update(func(sessions []models.Session) []models.Session {
+		for _, session := range sessions {
+			if session.Key == key {
+				session.Status = enum.Error.String()
+				return []models.Session{session}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) FindSessionByID(id string, key string) (models.Session, error) {
+	session, err := r.get(id)
+	if err == nil && session.Key != key {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, r.open(&session)
+}
+
+// FindSessions lists sessions without their raw activities, the ones with the
+// most frustration signals first.
+func (r *memorySessionRepository) FindSessions(filter SessionFilter) ([]models.Session, error) {
+	return findSessions(r.iterate, r.sessionCipher, filter)
+}
+
+func (r *memorySessionRepository) CountSignalsByActivity(key string) ([]models.ActivitySignalCount, error) {
+	return countSignals(r.iterate, r.sessionCipher, key)
+}
+
+// IterateSessions calls fn for every session matching filter, oldest first
+// with ties broken by ID. Limit and Skip are ignored.
+func (r *memorySessionRepository) IterateSessions(filter SessionFilter, fn func(models.Session) error) error {
+	filter = r.withBlindIndexes(filter)
+	return r.iterate(filter.matches, func(session models.Session) error {
+		if err := r.open(&session); err != nil {
+			return err
+		}
+		return fn(session)
+	})
+}
+
+// SessionExists reports whether a session with id is stored, in any project.
+func (r *memorySessionRepository) SessionExists(id string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.sessions[id]
+	return ok, nil
+}
+
+func (r *memorySessionRepository) DeleteSessionsByID(ids []string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for _, id := range ids {
+		if _, ok := r.sessions[id]; ok {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// IterateExpiredSessions calls fn for every session matching criteria,
+// without its raw activities.
+func (r *memorySessionRepository) IterateExpiredSessions(criteria ExpiryCriteria, fn func(models.Session) error) error {
+	return r.iterate(criteria.matches, func(session models.Session) error {
+		withoutPayload(&session)
+		session.Encrypted = nil
+		return fn(session)
+	})
+}
+
+// ExpireSession strips the recorded payload of a session and marks it
+// Expired, unless it is on legal hold. It reports whether the session was expired.
+func (r *memorySessionRepository) ExpireSession(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.sessions[id]
+	if !ok {
+		return false, nil
+	}
+	session, err := decodeSession(value)
+	if err != nil || session.LegalHold || session.Status == enum.Expired.String() {
+		return false, err
+	}
+
+	now := time.Now()
+	withoutPayload(&session)
+	session.Status = enum.Expired.String()
+	session.ExpiredAt = &now
+	session.VideoUrl = nil
+	session.Signals = nil
+	session.SignalCount = 0
+	session.Device = models.Device{}
+	session.Encrypted = nil
+	session.Chunks = nil
+	return true, r.put(session)
+}
+
+func (r *memorySessionRepository) SetLegalHold(id string, key string, hold bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.sessions[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	session, err := decodeSession(value)
+	if err != nil {
+		return err
+	}
+	if session.Key != key {
+		return mongo.ErrNoDocuments
+	}
+	session.LegalHold = hold
+	return r.put(session)
+}
+
+// CompleteRender records the result of rendering a session still in progress:
+// Complete with videoURL, or Error when videoURL is nil.
+func (r *memorySessionRepository) CompleteRender(id string, videoURL *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.sessions[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	session, err := decodeSession(value)
+	if err != nil {
+		return err
+	}
+	if session.Status != enum.InProgress.String() {
+		return mongo.ErrNoDocuments
+	}
+	completeRender(&session, videoURL)
+	return r.put(session)
+}
+
+// RestartRender puts a rendered or failed session of the project of key back
+// in progress, without its video, for it to be rendered again.
+func (r *memorySessionRepository) RestartRender(id string, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.sessions[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	session, err := decodeSession(value)
+	if err != nil {
+		return err
+	}
+	if !restartRender(&session, key) {
+		return mongo.ErrNoDocuments
+	}
+	return r.put(session)
+}
+
+// RewrapDataKeys wraps the data key of every session encrypted under an older
+// master key with the active one. The payloads are left untouched.
+func (r *memorySessionRepository) RewrapDataKeys() (int64, error) {
+	if r.keyring == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	var rewrapped int64
+	var rewrapErr error
+	err := r.update(func(sessions []models.Session) []models.Session {
+		var changed []models.Session
+		for _, session := range sessions {
+			if session.Encrypted == nil {
+				continue
+			}
+			dataKey, ok, err := r.keyring.Rewrap(session.Encrypted.DataKey)
+			if err != nil {
+				rewrapErr = fmt.Errorf("session %s: %w", session.ID, err)
+				return nil
+			}
+			if ok {
+				session.Encrypted.DataKey = dataKey
+				changed = append(changed, session)
+			}
+		}
+		rewrapped = int64(len(changed))
+		return changed
+	})
+	if rewrapErr != nil {
+		return 0, rewrapErr
+	}
+	return rewrapped, err
+}
+
+// iterate calls fn on a snapshot of the sessions matching, in creation order,
+// without holding the lock so that fn may write.
+func (r *memorySessionRepository) iterate(match func(models.Session) bool, fn func(models.Session) error) error {
+	sessions, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if !match(session) {
+			continue
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot decodes every session in creation order.
+func (r *memorySessionRepository) snapshot() ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.decodeAll()
+}
+
+// update passes every session, in creation order, to fn under the write lock
+// and stores the ones it returns.
+func (r *memorySessionRepository) update(fn func([]models.Session) []models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions, err := r.decodeAll()
+	if err != nil {
+		return err
+	}
+	for _, session := range fn(sessions) {
+		if err := r.put(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAll decodes every session, ordered like the bolt creation index. The
+// caller holds the lock.
+func (r *memorySessionRepository) decodeAll() ([]models.Session, error) {
+	sessions := make([]models.Session, 0, len(r.sessions))
+	for _, value := range r.sessions {
+		session, err := decodeSession(value)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return bytes.Compare(createdKey(sessions[i]), createdKey(sessions[j])) < 0
+	})
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) get(id string) (models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	value, ok := r.sessions[id]
+	if !ok {
+		return models.Session{}, mongo.ErrNoDocuments
+	}
+	return decodeSession(value)
+}
+
+// put stores session; the caller holds the write lock.
+func (r *memorySessionRepository) put(session models.Session) error {
+	value, err := bson.Marshal(session)
+	if err != nil {
+		return err
+	}
+	r.sessions[session.ID] = value
+	return nil
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	chunksCollection = "session_chunks"
+	// maxSessionDocumentSize leaves headroom below the 16 MB BSON limit.
+	maxSessionDocumentSize = 15 * 1024 * 1024
+	sessionChunkSize       = 8 * 1024 * 1024
+)
+
+// sessionChunk is one slice of the payload of an oversized session.
+type sessionChunk struct {
+	SessionID string
+	Index     int
+	Data      []byte
+}
+
+// chunkedFields is the payload of a plaintext session moved out to chunks,
+// stored as gzipped JSON.
+type chunkedFields struct {
+	Activities src.ActivityGestureLogs
+	Events     []models.GestureEvent
+}
+
+// sealedChunkedFields is the payload of an encrypted session moved out to
+// chunks, stored as BSON so that the sealed bytes are not re-encoded.
+type sealedChunkedFields struct {
+	Activities []byte
+	Events     []byte
+}
+
+// marshalSession encodes session for insertion. When it does not fit in one
+// document, its activities and events are moved out to chunks, returned for
+// the caller to store first, and the session keeps a ChunkedPayload reference
+// instead.
+func marshalSession(session models.Session) (bson.Raw, []interface{}, error) {
+	raw, err := bson.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) <= maxSessionDocumentSize {
+		return raw, nil, nil
+	}
+
+	var payload []byte
+	var encoding string
+	if session.Encrypted != nil {
+		// The envelope is shared with the caller; the copy must not touch it.
+		encrypted := *session.Encrypted
+		payload, err = bson.Marshal(sealedChunkedFields{Activities: encrypted.Activities, Events: encrypted.Events})
+		if err != nil {
+			return nil, nil, err
+		}
+		encoding = models.ChunkEncodingSealed
+		encrypted.Activities, encrypted.Events = nil, nil
+		session.Encrypted = &encrypted
+	} else {
+		if payload, err = gzipJSON(chunkedFields{Activities: session.Activities, Events: session.Events}); err != nil {
+			return nil, nil, err
+		}
+		encoding = models.ChunkEncodingGzip
+		session.Activities.Activities, session.Events = nil, nil
+	}
+
+	var chunks []interface{}
+	for index := 0; index*sessionChunkSize < len(payload); index++ {
+		end := min((index+1)*sessionChunkSize, len(payload))
+		chunks = append(chunks, sessionChunk{SessionID: session.ID, Index: index, Data: payload[index*sessionChunkSize : end]})
+	}
+	session.Chunks = &models.ChunkedPayload{Count: len(chunks), Size: int64(len(payload)), Encoding: encoding}
+
+	if raw, err = bson.Marshal(session); err != nil {
+		return nil, nil, err
+	}
+	if len(raw) > maxSessionDocumentSize {
+		return nil, nil, fmt.Errorf("session %s is too large even without its activities and events", session.ID)
+	}
+	return raw, chunks, nil
+}
+
+// loadChunks reassembles the activities and events of a chunked session,
+// leaving them where they were before chunking: in Activities and Events or,
+// for an encrypted session, in Encrypted for open to decrypt.
+func (c *sessionRepository) loadChunks(ctx context.Context, session *models.Session) error {
+	if session.Chunks == nil {
+		return nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "index", Value: 1}})
+	cursor, err := c.database.Collection(chunksCollection).Find(ctx, bson.M{"sessionid": session.ID}, opts)
+	if err != nil {
+		return err
+	}
+	var chunks []sessionChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		return err
+	}
+	if err := assembleChunks(session, chunks); err != nil {
+		return fmt.Errorf("session %s: %w", session.ID, err)
+	}
+	return nil
+}
+
+// assembleChunks puts the payload of session, split in chunks sorted by index,
+// back in place.
+func assembleChunks(session *models.Session, chunks []sessionChunk) error {
+	if len(chunks) != session.Chunks.Count {
+		return fmt.Errorf("expected %d chunks, found %d", session.Chunks.Count, len(chunks))
+	}
+	payload := make([]byte, 0, session.Chunks.Size)
+	for i, chunk := range chunks {
+		if chunk.Index != i {
+			return fmt.Errorf("chunk %d is missing", i)
+		}
+		payload = append(payload, chunk.Data...)
+	}
+
+	switch session.Chunks.Encoding {
+	case models.ChunkEncodingSealed:
+		if session.Encrypted == nil {
+			return errors.New("sealed chunks without encryption envelope")
+		}
+		var fields sealedChunkedFields
+		if err := bson.Unmarshal(payload, &fields); err != nil {
+			return err
+		}
+		session.Encrypted.Activities, session.Encrypted.Events = fields.Activities, fields.Events
+	case models.ChunkEncodingGzip:
+		var fields chunkedFields
+		if err := gunzipJSON(payload, &fields); err != nil {
+			return err
+		}
+		session.Activities, session.Events = fields.Activities, fields.Events
+	default:
+		return fmt.Errorf("unsupported chunk encoding %q", session.Chunks.Encoding)
+	}
+	session.Chunks = nil
+	return nil
+}
+
+func (c *sessionRepository) deleteChunks(ctx context.Context, ids []string) error {
+	_, err := c.database.Collection(chunksCollection).DeleteMany(ctx, bson.M{"sessionid": bson.M{"$in": ids}})
+	return err
+}
+
+func insertChunks(ctx context.Context, collection *mongo.Collection, chunks []interface{}) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	_, err := collection.InsertMany(ctx, chunks)
+	return err
+}
+
+func gzipJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func gunzipJSON(data []byte, value interface{}) error {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, value)
+}
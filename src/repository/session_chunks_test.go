@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"nymphicus-service/src/models"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// oversizedSession has events too large for one document and hard to
+// compress, so that they take several chunks.
+func oversizedSession(t *testing.T) models.Session {
+	t.Helper()
+	session := sensitiveSession()
+	noise := make([]byte, 2*1024*1024)
+	for i := 0; i < 10; i++ {
+		if _, err := rand.Read(noise); err != nil {
+			t.Fatal(err)
+		}
+		session.Events = append(session.Events, models.GestureEvent{Type: "tap", Activity: secretActivity, Description: hex.EncodeToString(noise)})
+	}
+	return session
+}
+
+// roundTrip stores session as marshalSession would have it stored and reads
+// it back.
+func roundTrip(t *testing.T, session models.Session) (models.Session, int) {
+	t.Helper()
+	raw, chunks, err := marshalSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) > maxSessionDocumentSize {
+		t.Fatalf("document is %d bytes", len(raw))
+	}
+
+	var stored models.Session
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Chunks == nil {
+		return stored, 0
+	}
+	if len(stored.Events) != 0 || len(stored.Activities.Activities) != 0 {
+		t.Fatal("chunked session kept its activities or events in the document")
+	}
+	if stored.Encrypted != nil && (len(stored.Encrypted.Activities) != 0 || len(stored.Encrypted.Events) != 0) {
+		t.Fatal("chunked session kept its sealed activities or events in the document")
+	}
+
+	var loaded []sessionChunk
+	for _, chunk := range chunks {
+		loaded = append(loaded, chunk.(sessionChunk))
+	}
+	if err := assembleChunks(&stored, loaded); err != nil {
+		t.Fatal(err)
+	}
+	return stored, len(chunks)
+}
+
+func TestChunkedSessionRoundTrip(t *testing.T) {
+	session := oversizedSession(t)
+	stored, chunks := roundTrip(t, session)
+	if chunks < 2 {
+		t.Errorf("got %d chunks, want several", chunks)
+	}
+	if !reflect.DeepEqual(stored.Events, session.Events) || !reflect.DeepEqual(stored.Activities, session.Activities) {
+		t.Error("activities or events changed through chunking")
+	}
+}
+
+func TestSealedChunkedSessionRoundTrip(t *testing.T) {
+	cipher := sessionCipher{keyring: testKeyring(t)}
+	session := oversizedSession(t)
+	sealed, err := cipher.seal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedEvents := sealed.Encrypted.Events
+
+	stored, chunks := roundTrip(t, sealed)
+	if chunks < 2 {
+		t.Errorf("got %d chunks, want several", chunks)
+	}
+	if len(sealed.Encrypted.Events) != len(sealedEvents) {
+		t.Error("marshalSession changed the envelope of its argument")
+	}
+	if err := cipher.open(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Events, session.Events) || !reflect.DeepEqual(stored.Activities, session.Activities) {
+		t.Error("activities or events changed through sealed chunking")
+	}
+}
+
+func TestMissingChunk(t *testing.T) {
+	_, chunks, err := marshalSession(oversizedSession(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{Chunks: &models.ChunkedPayload{Count: len(chunks), Encoding: models.ChunkEncodingGzip}}
+	loaded := []sessionChunk{chunks[0].(sessionChunk), chunks[0].(sessionChunk)}
+	if err := assembleChunks(&session, loaded); err == nil {
+		t.Error("assembled a session with a missing chunk")
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/src/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionCipher seals session payloads when keyring is not nil. Every session
+// repository embeds it, whatever its backend.
+type sessionCipher struct {
+	keyring *envelope.Keyring
+}
+
+// seal moves the Activities, Device, Events, Signals and Masks of session into
+// an EncryptedPayload when encryption is enabled. The session ID is bound to
+// the ciphertexts so that payloads cannot be swapped between documents.
+func (c sessionCipher) seal(session models.Session) (models.Session, error) {
+	if c.keyring == nil {
+		return session, nil
+	}
+
+	dataKey, wrapped, err := c.keyring.NewDataKey()
+	if err != nil {
+		return session, err
+	}
+	payload := &models.EncryptedPayload{DataKey: wrapped}
+	for _, field := range []struct {
+		sealed *[]byte
+		value  interface{}
+	}{
+		{&payload.Activities, session.Activities},
+		{&payload.Device, session.Device},
+		{&payload.Events, session.Events},
+		{&payload.Signals, session.Signals},
+		{&payload.Masks, session.Masks},
+	} {
+		if *field.sealed, err = sealJSON(dataKey, field.value, session.ID); err != nil {
+			return session, err
+		}
+	}
+
+	session.Encrypted = payload
+	session.Activities.Activities = nil
+	session.Device = models.Device{
+		Platform:   session.Device.Platform,
+		AppVersion: session.Device.AppVersion,
+		InstallID:  c.keyring.BlindIndex(session.Device.InstallID),
+	}
+	session.Events = nil
+	session.Masks = nil
+	// Sessions are filtered by signal type, so the types stay in plaintext.
+	signalTypes := make([]models.FrustrationSignal, 0, len(session.Signals))
+	for _, signal := range session.Signals {
+		signalTypes = append(signalTypes, models.FrustrationSignal{Type: signal.Type})
+	}
+	session.Signals = signalTypes
+	return session, nil
+}
+
+// open restores what seal moved into the EncryptedPayload of a session.
+// Sessions stored before encryption was enabled are returned as they are, and
+// so are Activities and Events when the query projected them out. Sessions
+// sealed before Events, Signals and Masks were keep them in plaintext.
+func (c sessionCipher) open(session *models.Session) error {
+	if session.Encrypted == nil {
+		return nil
+	}
+	if c.keyring == nil {
+		return fmt.Errorf("session %s is encrypted but no keyfile is configured", session.ID)
+	}
+
+	dataKey, err := c.keyring.Unwrap(session.Encrypted.DataKey)
+	if err != nil {
+		return fmt.Errorf("session %s: %w", session.ID, err)
+	}
+	for _, field := range []struct {
+		sealed []byte
+		value  interface{}
+	}{
+		{session.Encrypted.Activities, &session.Activities},
+		{session.Encrypted.Device, &session.Device},
+		{session.Encrypted.Events, &session.Events},
+		{session.Encrypted.Signals, &session.Signals},
+		{session.Encrypted.Masks, &session.Masks},
+	} {
+		if len(field.sealed) == 0 {
+			continue
+		}
+		if err := openJSON(dataKey, field.sealed, session.ID, field.value); err != nil {
+			return fmt.Errorf("session %s: %w", session.ID, err)
+		}
+	}
+	session.Encrypted = nil
+	return nil
+}
+
+// withBlindIndexes adds the blind indexes of the install IDs of filter, so
+// that encrypted and plaintext sessions both match.
+func (c sessionCipher) withBlindIndexes(filter SessionFilter) SessionFilter {
+	if c.keyring != nil && len(filter.InstallIDs) > 0 {
+		installIDs := make([]string, 0, 2*len(filter.InstallIDs))
+		for _, installID := range filter.InstallIDs {
+			installIDs = append(installIDs, installID, c.keyring.BlindIndex(installID))
+		}
+		filter.InstallIDs = installIDs
+	}
+	return filter
+}
+
+// RewrapDataKeys wraps the data key of every session encrypted under an older
+// master key with the active one. The payloads are left untouched.
+func (c *sessionRepository) RewrapDataKeys() (int64, error) {
+	if c.keyring == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	filter := bson.M{
+		"encrypted":               bson.M{"$ne": nil},
+		"encrypted.datakey.keyid": bson.M{"$ne": c.keyring.ActiveKeyID()},
+	}
+	opts := options.Find().SetProjection(bson.M{"id": 1, "encrypted.datakey": 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rewrapped int64
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return rewrapped, err
+		}
+		dataKey, changed, err := c.keyring.Rewrap(session.Encrypted.DataKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("session %s: %w", session.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"encrypted.datakey": dataKey}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"id": session.ID}, update); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, cursor.Err()
+}
+
+func sealJSON(dataKey []byte, value interface{}, sessionID string) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Seal(dataKey, data, []byte(sessionID))
+}
+
+func openJSON(dataKey []byte, sealed []byte, sessionID string, value interface{}) error {
+	data, err := envelope.Open(dataKey, sealed, []byte(sessionID))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
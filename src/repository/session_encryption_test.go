@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"bytes"
+	"nymphicus-service/pkg/envelope"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const secretActivity = "com.example.SecretPaymentActivity"
+
+func testKeyring(t *testing.T) *envelope.Keyring {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keyfile.json")
+	if err := envelope.AddKey(path, "test"); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := envelope.LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func sensitiveSession() models.Session {
+	return models.Session{
+		ID:        "11111111-1111-1111-1111-111111111111",
+		Key:       "project",
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+		Activities: src.ActivityGestureLogs{Activities: []src.ActivityGesture{
+			{ActivityName: secretActivity, Gestures: []src.Gesture{{Actions: []src.Action{{Action: "DOWN", TargetTime: "1", Coordinates: "1,2"}}}}},
+		}},
+		Device: models.Device{Platform: "android", InstallID: "install"},
+		Events: []models.GestureEvent{
+			{Type: "tap", Activity: secretActivity, StartTime: 1, EndTime: 2, Start: src.Point{X: 1, Y: 2}},
+		},
+		Signals: []models.FrustrationSignal{
+			{Type: "rage-tap", Activity: secretActivity, StartTime: 1, EndTime: 2, Count: 3},
+		},
+		SignalCount: 1,
+		Masks:       []models.MaskedSegment{{Activity: secretActivity, Mode: models.MaskBlur, Start: 0, End: 2}},
+	}
+}
+
+func TestSealHidesGestureData(t *testing.T) {
+	cipher := sessionCipher{keyring: testKeyring(t)}
+	session := sensitiveSession()
+
+	sealed, err := cipher.seal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed.Events) != 0 || len(sealed.Masks) != 0 || len(sealed.Activities.Activities) != 0 {
+		t.Fatalf("seal left gesture data in plaintext: %+v", sealed)
+	}
+	if want := []models.FrustrationSignal{{Type: "rage-tap"}}; !reflect.DeepEqual(sealed.Signals, want) {
+		t.Errorf("plaintext signals = %+v, want only their types", sealed.Signals)
+	}
+
+	opened := sealed
+	if err := cipher.open(&opened); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opened, session) {
+		t.Errorf("open(seal(session)) =\n%+v\nwant\n%+v", opened, session)
+	}
+}
+
+func TestEncryptedSessionsAtRest(t *testing.T) {
+	repo := NewMemorySessionRepository(testKeyring(t))
+	session := sensitiveSession()
+	if err := repo.SaveActionsToMongo(session); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := repo.(*memorySessionRepository).sessions[session.ID]
+	if bytes.Contains(stored, []byte(secretActivity)) {
+		t.Fatal("stored document contains an activity name")
+	}
+
+	sessions, err := repo.FindSessions(SessionFilter{Key: session.Key, Signal: "rage-tap"})
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("FindSessions by signal = %d sessions, %v", len(sessions), err)
+	}
+	if !reflect.DeepEqual(sessions[0].Signals, session.Signals) {
+		t.Errorf("listed signals = %+v, want %+v", sessions[0].Signals, session.Signals)
+	}
+
+	counts, err := repo.CountSignalsByActivity(session.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.ActivitySignalCount{{Activity: secretActivity, Type: "rage-tap", Count: 1, Sessions: 1}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("CountSignalsByActivity = %+v, want %+v", counts, want)
+	}
+}
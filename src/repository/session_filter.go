@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultSessionLimit = 50
+	maxSessionLimit     = 500
+)
+
+// SessionFilter narrows the sessions of a project. Zero values are ignored,
+// including Key, which only admin operations may leave empty to span every project.
+type SessionFilter struct {
+	Key        string
+	InstallIDs []string
+	Status     string
+	Signal     string
+	Platform   string
+	AppVersion string
+	From       time.Time
+	To         time.Time
+	Limit      int64
+	Skip       int64
+	// After resumes an iteration right after the given session.
+	After *SessionCursor
+}
+
+// SessionCursor is the position of a session in creation order, ties broken by ID.
+type SessionCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the cursor as an opaque resume token.
+func (c SessionCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMilli(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeSessionCursor parses a resume token made by SessionCursor.Encode.
+func DecodeSessionCursor(token string) (SessionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return SessionCursor{}, errors.New("invalid resume token")
+	}
+	millis, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return SessionCursor{}, errors.New("invalid resume token")
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return SessionCursor{}, errors.New("invalid resume token")
+	}
+	return SessionCursor{CreatedAt: time.UnixMilli(ms), ID: id}, nil
+}
+
+func (f SessionFilter) query() bson.M {
+	query := bson.M{}
+	if f.Key != "" {
+		query["key"] = f.Key
+	}
+	if len(f.InstallIDs) > 0 {
+		query["device.installid"] = bson.M{"$in": f.InstallIDs}
+	}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.Signal != "" {
+		query["signals.type"] = f.Signal
+	}
+	if f.Platform != "" {
+		query["device.platform"] = f.Platform
+	}
+	if f.AppVersion != "" {
+		query["device.appversion"] = f.AppVersion
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		createdAt := bson.M{}
+		if !f.From.IsZero() {
+			createdAt["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			createdAt["$lt"] = f.To
+		}
+		query["createdat"] = createdAt
+	}
+	if f.After != nil {
+		// Mongo keeps dates to the millisecond, so compare at that precision.
+		createdAt := f.After.CreatedAt.Truncate(time.Millisecond)
+		query["$or"] = bson.A{
+			bson.M{"createdat": bson.M{"$gt": createdAt}},
+			bson.M{"createdat": createdAt, "id": bson.M{"$gt": f.After.ID}},
+		}
+	}
+	return query
+}
+
+// matches reports whether session satisfies the filter, like query does, for
+// backends that cannot run Mongo queries.
+func (f SessionFilter) matches(session models.Session) bool {
+	if f.Key != "" && session.Key != f.Key {
+		return false
+	}
+	if len(f.InstallIDs) > 0 && !slices.Contains(f.InstallIDs, session.Device.InstallID) {
+		return false
+	}
+	if f.Status != "" && session.Status != f.Status {
+		return false
+	}
+	if f.Signal != "" && !slices.ContainsFunc(session.Signals, func(signal models.FrustrationSignal) bool {
+		return signal.Type == f.Signal
+	}) {
+		return false
+	}
+	if f.Platform != "" && session.Device.Platform != f.Platform {
+		return false
+	}
+	if f.AppVersion != "" && session.Device.AppVersion != f.AppVersion {
+		return false
+	}
+	createdAt := session.CreatedAt.Truncate(time.Millisecond)
+	if !f.From.IsZero() && createdAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !createdAt.Before(f.To) {
+		return false
+	}
+	if f.After != nil {
+		after := f.After.CreatedAt.Truncate(time.Millisecond)
+		if createdAt.Before(after) || createdAt.Equal(after) && session.ID <= f.After.ID {
+			return false
+		}
+	}
+	return true
+}
+
+func (f SessionFilter) limit() int64 {
+	if f.Limit <= 0 {
+		return defaultSessionLimit
+	}
+	if f.Limit > maxSessionLimit {
+		return maxSessionLimit
+	}
+	return f.Limit
+}
+
+// ExpiryCriteria selects the sessions past retention: the ones of Key, or of
+// every project but ExcludeKeys when Key is empty, created before
+// CreatedBefore and not expired yet. Sessions on legal hold are included so
+// that callers can report them.
+type ExpiryCriteria struct {
+	Key           string
+	ExcludeKeys   []string
+	CreatedBefore time.Time
+}
+
+func (c ExpiryCriteria) matches(session models.Session) bool {
+	if !session.CreatedAt.Before(c.CreatedBefore) || session.Status == enum.Expired.String() {
+		return false
+	}
+	if c.Key != "" {
+		return session.Key == c.Key
+	}
+	return !slices.Contains(c.ExcludeKeys, session.Key)
+}
+
+func (c ExpiryCriteria) query() bson.M {
+	query := bson.M{
+		"createdat": bson.M{"$lt": c.CreatedBefore},
+		"status":    bson.M{"$ne": enum.Expired.String()},
+	}
+	if c.Key != "" {
+		query["key"] = c.Key
+	} else if len(c.ExcludeKeys) > 0 {
+		query["key"] = bson.M{"$nin": c.ExcludeKeys}
+	}
+	return query
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestSessionCursorRoundTrip(t *testing.T) {
+	cursor := SessionCursor{CreatedAt: time.UnixMilli(1700000000123), ID: "6eff1da3-8962-4343-8a69-3175e25ede56"}
+	decoded, err := DecodeSessionCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeSessionCursorRejects(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	for _, token := range []string{"not base64!", encode("1700000000000"), encode("1700000000000:"), encode("soon:id")} {
+		if _, err := DecodeSessionCursor(token); err == nil {
+			t.Errorf("accepted %q", token)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"nymphicus-service/src/models"
+	"sort"
+)
+
+// sessionIterator calls fn for every stored session match accepts, like the
+// iterate method of the bolt and memory repositories.
+type sessionIterator func(match func(models.Session) bool, fn func(models.Session) error) error
+
+// findSessions implements FindSessions over iterate: the sessions matching
+// filter without their raw payload, the ones with the most frustration
+// signals first. Only the page returned is opened.
+func findSessions(iterate sessionIterator, cipher sessionCipher, filter SessionFilter) ([]models.Session, error) {
+	filter = cipher.withBlindIndexes(filter)
+	sessions := make([]models.Session, 0)
+	err := iterate(filter.matches, func(session models.Session) error {
+		withoutPayload(&session)
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].SignalCount != sessions[j].SignalCount {
+			return sessions[i].SignalCount > sessions[j].SignalCount
+		}
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	start := min(filter.Skip, int64(len(sessions)))
+	end := min(start+filter.limit(), int64(len(sessions)))
+	sessions = sessions[start:end]
+
+	for i := range sessions {
+		if err := cipher.open(&sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// countSignals implements CountSignalsByActivity over iterate.
+func countSignals(iterate sessionIterator, cipher sessionCipher, key string) ([]models.ActivitySignalCount, error) {
+	counter := newSignalCounter()
+	err := iterate(func(session models.Session) bool {
+		return session.Key == key && session.SignalCount > 0
+	}, func(session models.Session) error {
+		if err := cipher.open(&session); err != nil {
+			return err
+		}
+		counter.add(session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counter.result(), nil
+}
@@ -2,24 +2,44 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/envelope"
 	"nymphicus-service/src/models"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SessionRepository interface {
 	SaveActionsToMongo(actions models.Session) error
 	UpdateSessionStatusToError(key string) error
+	FindSessionByID(id string, key string) (models.Session, error)
+	SessionExists(id string) (bool, error)
+	FindSessions(filter SessionFilter) ([]models.Session, error)
+	CountSignalsByActivity(key string) ([]models.ActivitySignalCount, error)
+	IterateSessions(filter SessionFilter, fn func(models.Session) error) error
+	DeleteSessionsByID(ids []string) (int64, error)
+	IterateExpiredSessions(criteria ExpiryCriteria, fn func(models.Session) error) error
+	ExpireSession(id string) (bool, error)
+	SetLegalHold(id string, key string, hold bool) error
+	CompleteRender(id string, videoURL *string) error
+	RestartRender(id string, key string) error
+	RewrapDataKeys() (int64, error)
 }
 
 type sessionRepository struct {
+	sessionCipher
 	database *mongo.Database
 }
 
-func NewSessionRepository(database *mongo.Database) SessionRepository {
-	return &sessionRepository{database: database}
+// NewSessionRepository returns a repository that encrypts the activities and
+// device of the sessions it saves when keyring is not nil.
+func NewSessionRepository(database *mongo.Database, keyring *envelope.Keyring) SessionRepository {
+	return &sessionRepository{sessionCipher: sessionCipher{keyring: keyring}, database: database}
 }
 
 func (c *sessionRepository) SaveActionsToMongo(actions models.Session) error {
@@ -28,7 +48,24 @@ func (c *sessionRepository) SaveActionsToMongo(actions models.Session) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := collection.InsertOne(ctx, actions)
+	actions, err := c.seal(actions)
+	if err != nil {
+		return err
+	}
+	document, chunks, err := marshalSession(actions)
+	if err != nil {
+		return err
+	}
+
+	// Chunks go first so that a stored session never points to missing ones.
+	if err := insertChunks(ctx, c.database.Collection(chunksCollection), chunks); err != nil {
+		return err
+	}
+	if _, err = collection.InsertOne(ctx, document); err != nil && len(chunks) > 0 {
+		if cleanupErr := c.deleteChunks(ctx, []string{actions.ID}); cleanupErr != nil {
+			return errors.Join(err, fmt.Errorf("delete chunks of session %s: %w", actions.ID, cleanupErr))
+		}
+	}
 	return err
 }
 
@@ -48,3 +85,301 @@ func (c *sessionRepository) UpdateSessionStatusToError(key string) error {
 	_, err := collection.UpdateOne(ctx, filter, update)
 	return err
 }
+
+func (c *sessionRepository) FindSessionByID(id string, key string) (models.Session, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var session models.Session
+	filter := bson.M{"id": id, "key": key}
+	if err := collection.FindOne(ctx, filter).Decode(&session); err != nil {
+		return session, err
+	}
+	if err := c.loadChunks(ctx, &session); err != nil {
+		return session, err
+	}
+	return session, c.open(&session)
+}
+
+// SessionExists reports whether a session with id is stored, in any project.
+func (c *sessionRepository) SessionExists(id string) (bool, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := collection.CountDocuments(ctx, bson.M{"id": id}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// FindSessions lists sessions without their raw activities, the ones with the
+// most frustration signals first.
+func (c *sessionRepository) FindSessions(filter SessionFilter) ([]models.Session, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"activities": 0, "events": 0, "encrypted.activities": 0, "encrypted.events": 0}).
+		SetSort(bson.D{{Key: "signalcount", Value: -1}, {Key: "createdat", Value: -1}}).
+		SetSkip(filter.Skip).
+		SetLimit(filter.limit())
+
+	cursor, err := collection.Find(ctx, c.withBlindIndexes(filter).query(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0)
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if err := c.open(&sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+func (c *sessionRepository) CountSignalsByActivity(key string) ([]models.ActivitySignalCount, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The signals of encrypted sessions are counted once opened, the others
+	// by the aggregation.
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"key": key, "encrypted": nil}}},
+		{{Key: "$unwind", Value: "$signals"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"activity": "$signals.activity", "type": "$signals.type"},
+			"count":    bson.M{"$sum": 1},
+			"sessions": bson.M{"$addToSet": "$id"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"activity": "$_id.activity",
+			"type":     "$_id.type",
+			"count":    1,
+			"sessions": bson.M{"$size": "$sessions"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []models.ActivitySignalCount
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	counter := newSignalCounter()
+	counter.merge(counts)
+
+	opts := options.Find().SetProjection(bson.M{"id": 1, "signals": 1, "encrypted.datakey": 1, "encrypted.signals": 1})
+	cursor, err = collection.Find(ctx, bson.M{"key": key, "encrypted": bson.M{"$ne": nil}, "signalcount": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		if err := c.open(&session); err != nil {
+			return nil, err
+		}
+		counter.add(session)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return counter.result(), nil
+}
+
+// IterateSessions calls fn for every session matching filter, oldest first
+// with ties broken by ID, decoding one document at a time. Limit and Skip are ignored.
+func (c *sessionRepository) IterateSessions(filter SessionFilter, fn func(models.Session) error) error {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "id", Value: 1}})
+	cursor, err := collection.Find(ctx, c.withBlindIndexes(filter).query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return err
+		}
+		if err := c.loadChunks(ctx, &session); err != nil {
+			return err
+		}
+		if err := c.open(&session); err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (c *sessionRepository) DeleteSessionsByID(ids []string) (int64, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, c.deleteChunks(ctx, ids)
+}
+
+// IterateExpiredSessions calls fn for every session matching criteria,
+// without its raw activities.
+func (c *sessionRepository) IterateExpiredSessions(criteria ExpiryCriteria, fn func(models.Session) error) error {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"activities": 0, "events": 0, "encrypted": 0}).
+		SetSort(bson.D{{Key: "createdat", Value: 1}})
+	cursor, err := collection.Find(ctx, criteria.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return err
+		}
+		if err := c.open(&session); err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ExpireSession strips the recorded payload of a session and marks it
+// Expired, unless it was put on legal hold meanwhile. It reports whether the
+// session was expired.
+func (c *sessionRepository) ExpireSession(id string) (bool, error) {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "legalhold": bson.M{"$ne": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    enum.Expired.String(),
+			"expiredat": time.Now(),
+			"videourl":  nil,
+		},
+		"$unset": bson.M{
+			"activities":  "",
+			"events":      "",
+			"signals":     "",
+			"signalcount": "",
+			"device":      "",
+			"encrypted":   "",
+			"chunks":      "",
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+	return true, c.deleteChunks(ctx, []string{id})
+}
+
+func (c *sessionRepository) SetLegalHold(id string, key string, hold bool) error {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "key": key}
+	update := bson.M{"$set": bson.M{"legalhold": hold}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RestartRender puts a rendered or failed session of the project of key back
+// in progress, without its video, for it to be rendered again.
+func (c *sessionRepository) RestartRender(id string, key string) error {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "key": key, "status": bson.M{"$in": bson.A{enum.Complete.String(), enum.Error.String()}}}
+	update := bson.M{"$set": bson.M{"status": enum.InProgress.String(), "videourl": nil}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// CompleteRender records the result of rendering a session still in progress:
+// Complete with videoURL, or Error when videoURL is nil.
+func (c *sessionRepository) CompleteRender(id string, videoURL *string) error {
+	collection := c.database.Collection("sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "status": enum.InProgress.String()}
+	update := bson.M{"$set": bson.M{"status": enum.Error.String()}}
+	if videoURL != nil {
+		update = bson.M{"$set": bson.M{"status": enum.Complete.String(), "videourl": *videoURL}}
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"nymphicus-service/src/models"
+	"sort"
+)
+
+// signalCounter groups frustration signals by activity and type, like the
+// CountSignalsByActivity aggregation, for sessions counted outside Mongo.
+type signalCounter struct {
+	counts   map[signalGroup]*models.ActivitySignalCount
+	sessions map[signalGroup]map[string]bool
+}
+
+type signalGroup struct{ activity, signalType string }
+
+func newSignalCounter() *signalCounter {
+	return &signalCounter{
+		counts:   make(map[signalGroup]*models.ActivitySignalCount),
+		sessions: make(map[signalGroup]map[string]bool),
+	}
+}
+
+// add counts the signals of an opened session.
+func (c *signalCounter) add(session models.Session) {
+	for _, signal := range session.Signals {
+		g := signalGroup{signal.Activity, signal.Type}
+		if c.counts[g] == nil {
+			c.counts[g] = &models.ActivitySignalCount{Activity: signal.Activity, Type: signal.Type}
+			c.sessions[g] = make(map[string]bool)
+		}
+		c.counts[g].Count++
+		if !c.sessions[g][session.ID] {
+			c.sessions[g][session.ID] = true
+			c.counts[g].Sessions++
+		}
+	}
+}
+
+// merge adds counts computed over other sessions than those added.
+func (c *signalCounter) merge(counts []models.ActivitySignalCount) {
+	for _, count := range counts {
+		g := signalGroup{count.Activity, count.Type}
+		if c.counts[g] == nil {
+			c.counts[g] = &models.ActivitySignalCount{Activity: count.Activity, Type: count.Type}
+			c.sessions[g] = make(map[string]bool)
+		}
+		c.counts[g].Count += count.Count
+		c.counts[g].Sessions += count.Sessions
+	}
+}
+
+// result returns the groups, the most frequent first.
+func (c *signalCounter) result() []models.ActivitySignalCount {
+	result := make([]models.ActivitySignalCount, 0, len(c.counts))
+	for _, count := range c.counts {
+		result = append(result, *count)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if result[i].Activity != result[j].Activity {
+			return result[i].Activity < result[j].Activity
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
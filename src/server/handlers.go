@@ -5,27 +5,128 @@ import (
 	"nymphicus-service/src/controllers"
 	"nymphicus-service/src/controllers/health"
 	controllerv2 "nymphicus-service/src/controllers/v2"
-	"nymphicus-service/src/repository"
 	service "nymphicus-service/src/services"
+	"strings"
 )
 
+const sessionsPathPrefix = "/v2/sessions/"
+
 func (s *Server) handler(ctx *fasthttp.RequestCtx) {
 
-	sessionRepository := repository.NewSessionRepository(s.mongo)
+	sessionRepository := s.stores.Sessions
+	auditRepository := s.stores.Audit
+	accessKeyRepository := s.stores.AccessKeys
 
-	videoService := service.NewVideoService(s.cfg)
+	videoService := service.NewVideoService(s.cfg, s.otididae, s.renders, sessionRepository)
+	gestureClassifier := service.NewGestureClassifier()
+	frustrationDetector := service.NewFrustrationDetector()
+	scriptExporter := service.NewScriptExporter()
+	reproductionSteps := service.NewReproductionSteps()
+	sessionTimeline := service.NewSessionTimeline()
+	manifestBuilder := service.NewReplayManifestBuilder(sessionTimeline)
+	sessionExporter := service.NewSessionExporter(sessionRepository)
+	sessionArchiver := service.NewSessionArchiver(s.cfg, sessionRepository)
+	devicePrivacy := service.NewDevicePrivacy(s.cfg)
+	dataSubjectService := service.NewDataSubjectService(sessionRepository, videoService, devicePrivacy)
+	auditLog := service.NewAuditLog(s.cfg, auditRepository)
+	retentionService := service.NewRetentionService(s.cfg, sessionRepository, videoService)
 
-	checkRecordingController := controllers.NewCheckRecordingController(s.cfg, s.logger, s.redis)
-	writeVideoDataController := controllerv2.NewWriteVideoDataController(s.cfg, s.logger, sessionRepository, videoService)
+	checkRecordingController := controllers.NewCheckRecordingController(s.cfg, s.logger, accessKeyRepository)
+	writeVideoDataController := controllerv2.NewWriteVideoDataController(s.cfg, s.logger, sessionRepository, videoService, gestureClassifier, frustrationDetector, devicePrivacy, s.masking)
+	sessionController := controllerv2.NewSessionController(s.cfg, s.logger, sessionRepository, gestureClassifier, frustrationDetector, scriptExporter, reproductionSteps, sessionTimeline, manifestBuilder, sessionExporter, auditLog)
+	analyticsController := controllerv2.NewAnalyticsController(s.cfg, s.logger, sessionRepository, gestureClassifier)
+	adminController := controllerv2.NewAdminController(s.cfg, s.logger, sessionArchiver, sessionExporter, dataSubjectService, auditLog, retentionService, sessionRepository, accessKeyRepository, videoService, s.otididae, s.renders)
 
-	switch string(ctx.Path()) {
+	path := string(ctx.Path())
+	switch path {
 	case "/v2/write":
 		writeVideoDataController.WriteVideoData(ctx)
+	case "/v2/sessions":
+		sessionController.ListSessions(ctx)
+	case "/v2/exports/sessions":
+		sessionController.ExportSessions(ctx)
+	case "/v2/analytics/signals":
+		analyticsController.SignalsByActivity(ctx)
+	case "/v2/analytics/flow":
+		analyticsController.ScreenFlow(ctx)
+	case "/v2/analytics/funnel":
+		analyticsController.Funnel(ctx)
+	case "/v2/analytics/heatmap":
+		analyticsController.Heatmap(ctx)
+	case "/v2/admin/archive":
+		adminController.ArchiveSessions(ctx)
+	case restorePath:
+		adminController.RestoreSessions(ctx)
+	case "/v2/admin/subjects/export":
+		adminController.ExportSubject(ctx)
+	case "/v2/admin/subjects/delete":
+		adminController.DeleteSubject(ctx)
+	case "/v2/admin/retention/report":
+		adminController.RetentionReport(ctx)
+	case "/v2/admin/retention/sweep":
+		adminController.RetentionSweep(ctx)
+	case "/v2/admin/sessions/legal-hold":
+		adminController.SetLegalHold(ctx)
+	case "/v2/admin/sessions/delete":
+		adminController.DeleteSession(ctx)
+	case "/v2/admin/sessions/rerender":
+		adminController.RerenderSession(ctx)
+	case "/v2/admin/keys":
+		adminController.CreateAccessKey(ctx)
+	case "/v2/admin/keys/revoke":
+		adminController.RevokeAccessKey(ctx)
+	case "/v2/admin/audit":
+		adminController.AuditRecords(ctx)
+	case "/v2/admin/audit/verify":
+		adminController.VerifyAudit(ctx)
+	case "/v2/admin/renderers":
+		adminController.RendererStatus(ctx)
+	case "/v2/admin/renders/queue":
+		adminController.RenderQueue(ctx)
+	case "/v2/renders/complete":
+		adminController.CompleteRender(ctx)
 	case "/check-recording":
 		checkRecordingController.ValidateAccessKey(ctx)
 	case "/health":
 		health.CheckHandler(ctx)
 	default:
-		ctx.Error("Unsupported path", fasthttp.StatusNotFound)
+		id, resource, ok := splitSessionPath(path)
+		if !ok {
+			ctx.Error("Unsupported path", fasthttp.StatusNotFound)
+			return
+		}
+		ctx.SetUserValue("id", id)
+		switch resource {
+		case "":
+			sessionController.GetSession(ctx)
+		case "export":
+			sessionController.ExportSession(ctx)
+		case "steps":
+			sessionController.ReproductionSteps(ctx)
+		case "timeline.vtt":
+			ctx.SetUserValue("format", "vtt")
+			sessionController.Timeline(ctx)
+		case "timeline.srt":
+			ctx.SetUserValue("format", "srt")
+			sessionController.Timeline(ctx)
+		case "manifest":
+			sessionController.Manifest(ctx)
+		default:
+			ctx.Error("Unsupported path", fasthttp.StatusNotFound)
+		}
+	}
+}
+
+// splitSessionPath splits "/v2/sessions/{id}/{resource}" into its id and
+// optional resource.
+func splitSessionPath(path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, sessionsPathPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, resource, _ := strings.Cut(rest, "/")
+	if id == "" || strings.Contains(resource, "/") {
+		return "", "", false
 	}
+	return id, resource, true
 }
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"nymphicus-service/enum"
+	service "nymphicus-service/src/services"
+	"time"
+)
+
+const retentionActor = "retention-sweeper"
+
+// runRetentionSweeper expires the sessions past retention every
+// Retention.SweepInterval minutes until stop is closed.
+func (s *Server) runRetentionSweeper(stop <-chan struct{}) {
+	interval := time.Minute * s.cfg.Retention.SweepInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	retentionService := service.NewRetentionService(s.cfg, s.stores.Sessions, service.NewVideoService(s.cfg, s.otididae, s.renders, s.stores.Sessions))
+	auditLog := service.NewAuditLog(s.cfg, s.stores.Audit)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// Sessions are only purged once the sweep is on record, and
+			// sweeps with nothing to purge are not worth one.
+			planned, err := retentionService.Sweep(true)
+			if err != nil {
+				s.logger.Errorf("Retention sweep failed: %v", err)
+				continue
+			}
+			if expired, _, _ := planned.Totals(); expired == 0 {
+				continue
+			}
+			if err := auditLog.Record(retentionActor, enum.RetentionSweep, "sessions", map[string]string{"status": "started"}); err != nil {
+				s.logger.Errorf("Retention sweep skipped, audit record failed: %v", err)
+				continue
+			}
+
+			report, err := retentionService.Sweep(false)
+			if err != nil {
+				s.logger.Errorf("Retention sweep failed: %v", err)
+			}
+			if err := auditLog.Record(retentionActor, enum.RetentionSweep, "sessions", service.RetentionAuditDetails(report, err)); err != nil {
+				s.logger.Errorf("Retention sweep, audit record failed: %v", err)
+			}
+		}
+	}
+}
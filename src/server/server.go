@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"errors"
-	"github.com/go-redis/redis/v8"
-	"go.mongodb.org/mongo-driver/mongo"
+	"fmt"
+	"io"
 	"nymphicus-service/config"
+	"nymphicus-service/database"
 	"nymphicus-service/pkg/logger"
+	service "nymphicus-service/src/services"
 	"os"
 	"os/signal"
 	"syscall"
@@ -18,14 +20,18 @@ import (
 const (
 	ctxTimeout         = 5
 	maxRequestBodySize = 50 * 1024 * 1024 // 50 MB
+	// restorePath takes session bundles, streamed without a size limit.
+	restorePath = "/v2/admin/restore"
 )
 
 type Server struct {
-	cfg    *config.Config
-	logger logger.Logger
-	mongo  *mongo.Database
-	srv    *fasthttp.Server
-	redis  *redis.Client
+	cfg      *config.Config
+	logger   logger.Logger
+	stores   *database.Stores
+	otididae service.OtididaeCluster
+	renders  service.RenderScheduler
+	masking  service.ActivityMasking
+	srv      *fasthttp.Server
 }
 
 func (s *Server) loggingMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
@@ -38,25 +44,69 @@ func (s *Server) loggingMiddleware(next fasthttp.RequestHandler) fasthttp.Reques
 	}
 }
 
+// bodyLimitMiddleware reads request bodies of up to maxRequestBodySize
+// before calling next, and rejects larger ones. Bodies are streamed to the
+// server, so that restorePath can take bundles of any size.
+func (s *Server) bodyLimitMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !ctx.Request.IsBodyStream() || string(ctx.Path()) == restorePath {
+			next(ctx)
+			return
+		}
+		if ctx.Request.Header.ContentLength() > maxRequestBodySize {
+			ctx.Error("Request body too large", fasthttp.StatusRequestEntityTooLarge)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(ctx.RequestBodyStream(), maxRequestBodySize+1))
+		if err != nil {
+			ctx.Error("Failed to read request body", fasthttp.StatusBadRequest)
+			return
+		}
+		if len(body) > maxRequestBodySize {
+			ctx.Error("Request body too large", fasthttp.StatusRequestEntityTooLarge)
+			return
+		}
+		ctx.Request.SetBody(body)
+		next(ctx)
+	}
+}
+
 // NewServer New Server constructor
-func NewServer(cfg *config.Config, logger logger.Logger, mongo *mongo.Database, redis *redis.Client) *Server {
+func NewServer(cfg *config.Config, logger logger.Logger, stores *database.Stores) (*Server, error) {
+	masking, err := service.NewActivityMasking(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("masking rules: %w", err)
+	}
+
+	otididae := service.NewOtididaeCluster(cfg)
 	server := &Server{
-		cfg:    cfg,
-		logger: logger,
-		mongo:  mongo,
+		cfg:      cfg,
+		logger:   logger,
+		stores:   stores,
+		otididae: otididae,
+		renders:  service.NewRenderScheduler(cfg, otididae, stores.Sessions),
+		masking:  masking,
 		srv: &fasthttp.Server{
 			Name:               "FastHTTP Server",
 			ReadTimeout:        time.Second * cfg.Server.ReadTimeout,
 			WriteTimeout:       time.Second * cfg.Server.WriteTimeout,
 			MaxRequestBodySize: maxRequestBodySize,
+			StreamRequestBody:  true,
+			// Multipart forms are parsed once bodyLimitMiddleware has
+			// checked their size.
+			DisablePreParseMultipartForm: true,
 		},
-		redis: redis,
 	}
-	return server
+	return server, nil
+}
+
+// Handler returns the HTTP API, for serving it in-process without Run.
+func (s *Server) Handler() fasthttp.RequestHandler {
+	return s.loggingMiddleware(s.bodyLimitMiddleware(s.handler))
 }
 
 func (s *Server) Run() error {
-	s.srv.Handler = s.loggingMiddleware(s.handler)
+	s.srv.Handler = s.Handler()
 
 	go func() {
 		s.logger.Infof("Server is listening on PORT: %s", s.cfg.Server.Port)
@@ -65,10 +115,23 @@ func (s *Server) Run() error {
 		}
 	}()
 
+	stop := make(chan struct{})
+	go s.otididae.RunHealthChecks(stop)
+	rendersStopped := make(chan struct{})
+	go func() {
+		s.renders.Run(stop)
+		close(rendersStopped)
+	}()
+	if s.cfg.Retention.Enabled {
+		go s.runRetentionSweeper(stop)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	<-quit
+	close(stop)
+	<-rendersStopped
 
 	ctx, shutdown := context.WithTimeout(context.Background(), ctxTimeout*time.Second)
 	defer shutdown()
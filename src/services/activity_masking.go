@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ActivityMasking applies the masking rules of a project to gesture logs
+// before they are stored.
+type ActivityMasking interface {
+	Apply(key string, logs src.ActivityGestureLogs, device models.Device, duration int64) (src.ActivityGestureLogs, []models.MaskedSegment)
+}
+
+type activityMasking struct {
+	defaults []compiledRule
+	projects map[string][]compiledRule
+}
+
+// NewActivityMasking compiles the masking rules of every project once, and
+// fails on the first invalid one.
+func NewActivityMasking(config *config.Config) (ActivityMasking, error) {
+	defaults, err := compileRules(config.DefaultProject.Masking)
+	if err != nil {
+		return nil, fmt.Errorf("defaultProject: %v", err)
+	}
+	masking := &activityMasking{defaults: defaults, projects: make(map[string][]compiledRule)}
+	for i, project := range config.Projects {
+		rules, err := compileRules(project.Masking)
+		if err != nil {
+			return nil, fmt.Errorf("projects[%d]: %v", i, err)
+		}
+		masking.projects[project.Key] = rules
+	}
+	return masking, nil
+}
+
+// rules returns the compiled rules of the project of key.
+func (m *activityMasking) rules(key string) []compiledRule {
+	if rules, ok := m.projects[key]; ok {
+		return rules
+	}
+	return m.defaults
+}
+
+// compiledRule is a MaskingRule with its pattern compiled.
+type compiledRule struct {
+	config.MaskingRule
+	pattern *regexp.Regexp
+}
+
+func (r compiledRule) matches(activityName string) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(activityName)
+	}
+	return r.Activity == activityName
+}
+
+// Apply masks every activity matched by a rule of the project of key, the
+// first matching rule winning, and returns the masked logs with the video
+// segments to blur. duration, in milliseconds, extends the last segment to the
+// end of the video like the timeline does. The input logs are not modified.
+func (m *activityMasking) Apply(key string, logs src.ActivityGestureLogs, device models.Device, duration int64) (src.ActivityGestureLogs, []models.MaskedSegment) {
+	rules := m.rules(key)
+	if len(rules) == 0 {
+		return logs, nil
+	}
+
+	origin := logs.Origin()
+	visits := logs.Visits()
+	masked := src.ActivityGestureLogs{Activities: make([]src.ActivityGesture, len(logs.Activities))}
+	segments := make([]models.MaskedSegment, 0)
+	for i, activity := range logs.Activities {
+		masked.Activities[i] = activity
+		rule, ok := matchRule(rules, activity.ActivityName)
+		if !ok {
+			continue
+		}
+
+		masked.Activities[i].Gestures = maskGestures(activity.Gestures, rule.Mode, device)
+		segment := models.MaskedSegment{
+			Activity:      activity.ActivityName,
+			ActivityIndex: i,
+			Mode:          rule.Mode,
+			Start:         visits[i].Start - origin,
+			End:           visits[i].End - origin,
+		}
+		if i == len(visits)-1 && duration > segment.End {
+			segment.End = duration
+		}
+		segments = append(segments, segment)
+	}
+	return masked, segments
+}
+
+func compileRules(rules []config.MaskingRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		switch rule.Mode {
+		case models.MaskDrop, models.MaskBlur, models.MaskStripText:
+		default:
+			return nil, fmt.Errorf("unsupported masking mode %q", rule.Mode)
+		}
+		if (rule.Activity == "") == (rule.Pattern == "") {
+			return nil, fmt.Errorf("masking rule needs exactly one of activity or pattern")
+		}
+
+		c := compiledRule{MaskingRule: rule}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid masking pattern %q: %v", rule.Pattern, err)
+			}
+			c.pattern = pattern
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func matchRule(rules []compiledRule, activityName string) (compiledRule, bool) {
+	for _, rule := range rules {
+		if rule.matches(activityName) {
+			return rule, true
+		}
+	}
+	return compiledRule{}, false
+}
+
+// maskGestures returns a copy of gestures masked with mode. Gestures left
+// without actions are removed.
+func maskGestures(gestures []src.Gesture, mode string, device models.Device) []src.Gesture {
+	if mode == models.MaskDrop {
+		return []src.Gesture{}
+	}
+
+	centre := ""
+	if width, height, ok := device.ScreenSize(); ok {
+		centre = strconv.FormatFloat(width/2, 'f', -1, 64) + "," + strconv.FormatFloat(height/2, 'f', -1, 64)
+	}
+
+	masked := make([]src.Gesture, 0, len(gestures))
+	for _, gesture := range gestures {
+		actions := make([]src.Action, 0, len(gesture.Actions))
+		for _, action := range gesture.Actions {
+			switch mode {
+			case models.MaskStripText:
+				if action.IsTextInput() {
+					continue
+				}
+			case models.MaskBlur:
+				action.Coordinates = blurCoordinates(action, centre)
+			}
+			actions = append(actions, action)
+		}
+		if len(actions) > 0 {
+			masked = append(masked, src.Gesture{Actions: actions})
+		}
+	}
+	return masked
+}
+
+// blurCoordinates moves every pointer of action to centre, keeping the pointer
+// count. Without a known screen size the coordinates are removed.
+func blurCoordinates(action src.Action, centre string) string {
+	points, err := action.Points()
+	if err != nil || centre == "" {
+		return ""
+	}
+	pointers := make([]string, len(points))
+	for i := range pointers {
+		pointers[i] = centre
+	}
+	return strings.Join(pointers, ";")
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"nymphicus-service/config"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"reflect"
+	"testing"
+)
+
+func newTestMasking(t *testing.T, rules ...config.MaskingRule) ActivityMasking {
+	t.Helper()
+	masking, err := NewActivityMasking(&config.Config{DefaultProject: config.ProjectConfig{Masking: rules}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return masking
+}
+
+func TestMaskingModes(t *testing.T) {
+	masking := newTestMasking(t,
+		config.MaskingRule{Activity: "Login", Mode: models.MaskDrop},
+		config.MaskingRule{Pattern: "^Pay", Mode: models.MaskBlur},
+		config.MaskingRule{Activity: "Search", Mode: models.MaskStripText},
+	)
+	logs := logsOf(screen{"Home", []int64{0}}, screen{"Login", []int64{1000}}, screen{"PayCard", []int64{2000}}, screen{"Search", []int64{3000}})
+	search := &logs.Activities[3]
+	search.Gestures = append(search.Gestures, src.Gesture{Actions: []src.Action{{Action: "KEY_A"}}})
+	typed := len(search.Gestures)
+
+	masked, segments := masking.Apply("key", logs, models.Device{ScreenResolution: "1080x1920"}, 5000)
+
+	if !reflect.DeepEqual(masked.Activities[0], logs.Activities[0]) {
+		t.Errorf("Home = %+v, want it untouched", masked.Activities[0])
+	}
+	if len(masked.Activities[1].Gestures) != 0 {
+		t.Errorf("Login kept %d gestures, want them dropped", len(masked.Activities[1].Gestures))
+	}
+	for _, action := range masked.Activities[2].Gestures[0].Actions {
+		if action.Coordinates != "540,960" {
+			t.Errorf("PayCard action at %q, want the screen centre", action.Coordinates)
+		}
+	}
+	if gestures := masked.Activities[3].Gestures; len(gestures) != 1 || gestures[0].Actions[0].IsTextInput() {
+		t.Errorf("Search gestures = %+v, want only the touch", gestures)
+	}
+	if len(logs.Activities[1].Gestures) != 1 || len(search.Gestures) != typed {
+		t.Error("Apply modified its input logs")
+	}
+
+	want := []models.MaskedSegment{
+		{Activity: "Login", ActivityIndex: 1, Mode: models.MaskDrop, Start: 1000, End: 2000},
+		{Activity: "PayCard", ActivityIndex: 2, Mode: models.MaskBlur, Start: 2000, End: 3000},
+		{Activity: "Search", ActivityIndex: 3, Mode: models.MaskStripText, Start: 3000, End: 5000},
+	}
+	if !reflect.DeepEqual(segments, want) {
+		t.Errorf("segments = %+v, want %+v", segments, want)
+	}
+}
+
+func TestMaskingFirstRuleWins(t *testing.T) {
+	masking := newTestMasking(t,
+		config.MaskingRule{Pattern: "Pay", Mode: models.MaskBlur},
+		config.MaskingRule{Activity: "PayCard", Mode: models.MaskDrop},
+	)
+	masked, segments := masking.Apply("key", logsOf(screen{"PayCard", []int64{0}}), models.Device{}, 1000)
+
+	if len(segments) != 1 || segments[0].Mode != models.MaskBlur {
+		t.Errorf("segments = %+v, want one blurred by the first rule", segments)
+	}
+	if len(masked.Activities[0].Gestures) != 1 || masked.Activities[0].Gestures[0].Actions[0].Coordinates != "" {
+		t.Errorf("PayCard = %+v, want its coordinates blurred away without a screen size", masked.Activities[0])
+	}
+}
+
+func TestMaskingLeadingUntimedSegment(t *testing.T) {
+	masking := newTestMasking(t, config.MaskingRule{Activity: "Splash", Mode: models.MaskDrop})
+	_, segments := masking.Apply("key", logsOf(screen{name: "Splash"}, screen{"Home", []int64{1000}}), models.Device{}, 3000)
+
+	want := []models.MaskedSegment{{Activity: "Splash", Mode: models.MaskDrop, Start: 0, End: 0}}
+	if !reflect.DeepEqual(segments, want) {
+		t.Errorf("segments = %+v, want %+v", segments, want)
+	}
+}
+
+func TestMaskingRulesPerProject(t *testing.T) {
+	masking, err := NewActivityMasking(&config.Config{
+		DefaultProject: config.ProjectConfig{Masking: []config.MaskingRule{{Activity: "Login", Mode: models.MaskDrop}}},
+		Projects:       []config.ProjectConfig{{Key: "open"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := logsOf(screen{"Login", []int64{0}})
+
+	if _, segments := masking.Apply("other", logs, models.Device{}, 1000); len(segments) != 1 {
+		t.Errorf("default project masked %d segments, want 1", len(segments))
+	}
+	if _, segments := masking.Apply("open", logs, models.Device{}, 1000); len(segments) != 0 {
+		t.Errorf("project without rules masked %d segments, want none", len(segments))
+	}
+}
+
+func TestMaskingRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []config.MaskingRule{
+		{Activity: "Login", Mode: "hide"},
+		{Mode: models.MaskDrop},
+		{Activity: "Login", Pattern: "Login", Mode: models.MaskDrop},
+		{Pattern: "(", Mode: models.MaskDrop},
+	} {
+		rules := []config.MaskingRule{rule}
+		if _, err := NewActivityMasking(&config.Config{DefaultProject: config.ProjectConfig{Masking: rules}}); err == nil {
+			t.Errorf("default rule %+v accepted", rule)
+		}
+		if _, err := NewActivityMasking(&config.Config{Projects: []config.ProjectConfig{{Key: "key", Masking: rules}}}); err == nil {
+			t.Errorf("project rule %+v accepted", rule)
+		}
+	}
+}
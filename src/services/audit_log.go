@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"strconv"
+	"strings"
+)
+
+// errChainBroken stops the walk of the audit log at the first broken record.
+var errChainBroken = errors.New("audit chain broken")
+
+// AuditVerification is the result of checking the audit log hash chain.
+// Records counts the records checked and BrokenAt is the sequence of the first
+// one that does not verify, where checking stops. Head is the last record
+// that verified, to be kept outside the log as the anchor of the next check.
+type AuditVerification struct {
+	Records  int64       `json:"records"`
+	Valid    bool        `json:"valid"`
+	BrokenAt int64       `json:"brokenAt,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Head     AuditAnchor `json:"head"`
+}
+
+// AuditAnchor pins the hash of one record of the audit log. The chain alone
+// cannot tell a log cut short from a shorter one; checked against an anchor
+// kept elsewhere, dropping the records up to it is caught.
+type AuditAnchor struct {
+	Sequence int64  `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// ParseAuditAnchor reads an anchor written as "sequence:hash".
+func ParseAuditAnchor(value string) (AuditAnchor, error) {
+	sequence, hash, ok := strings.Cut(value, ":")
+	if !ok || hash == "" {
+		return AuditAnchor{}, fmt.Errorf("invalid audit anchor %q, expected sequence:hash", value)
+	}
+	number, err := strconv.ParseInt(sequence, 10, 64)
+	if err != nil || number <= 0 {
+		return AuditAnchor{}, fmt.Errorf("invalid audit anchor sequence %q", sequence)
+	}
+	return AuditAnchor{Sequence: number, Hash: hash}, nil
+}
+
+// AuditLog records administrative actions in the hash-chained audit collection.
+type AuditLog interface {
+	Record(actor string, action enum.AuditAction, target string, details map[string]string) error
+	Find(filter repository.AuditFilter) ([]models.AuditRecord, error)
+	Verify(anchor AuditAnchor) (AuditVerification, error)
+}
+
+type auditLog struct {
+	auditRepository repository.AuditRepository
+	chainKey        []byte
+}
+
+// NewAuditLog checks the chain with Audit.ChainKey, the key the repositories
+// append with.
+func NewAuditLog(cfg *config.Config, auditRepository repository.AuditRepository) AuditLog {
+	return &auditLog{auditRepository: auditRepository, chainKey: []byte(cfg.Audit.ChainKey)}
+}
+
+func (a *auditLog) Record(actor string, action enum.AuditAction, target string, details map[string]string) error {
+	_, err := a.auditRepository.Append(models.AuditRecord{
+		Actor:   actor,
+		Action:  action.String(),
+		Target:  target,
+		Details: details,
+	})
+	return err
+}
+
+func (a *auditLog) Find(filter repository.AuditFilter) ([]models.AuditRecord, error) {
+	return a.auditRepository.FindRecords(filter)
+}
+
+// Verify walks the log and checks that sequences have no gap, that every
+// record links to the hash of the previous one and that its own hash matches
+// its content. It stops at the first record that does not verify. A non-zero
+// anchor must be found in the log as it was pinned.
+func (a *auditLog) Verify(anchor AuditAnchor) (AuditVerification, error) {
+	verification := AuditVerification{Valid: true}
+	previousHash := ""
+	err := a.auditRepository.IterateRecords(func(record models.AuditRecord) error {
+		verification.Records++
+
+		var reason string
+		switch {
+		case record.Sequence != verification.Records:
+			reason = fmt.Sprintf("expected sequence %d", verification.Records)
+		case record.PreviousHash != previousHash:
+			reason = "previous hash does not match the previous record"
+		case record.Hash != record.ComputeHash(a.chainKey):
+			reason = "hash does not match the record content"
+		case record.Sequence == anchor.Sequence && record.Hash != anchor.Hash:
+			reason = "hash does not match the anchor"
+		}
+		if reason != "" {
+			verification.Valid = false
+			verification.BrokenAt = record.Sequence
+			verification.Reason = reason
+			return errChainBroken
+		}
+		previousHash = record.Hash
+		verification.Head = AuditAnchor{Sequence: record.Sequence, Hash: record.Hash}
+		return nil
+	})
+	if errors.Is(err, errChainBroken) {
+		err = nil
+	}
+	if err == nil && verification.Valid && verification.Records < anchor.Sequence {
+		verification.Valid = false
+		verification.BrokenAt = verification.Records + 1
+		verification.Reason = fmt.Sprintf("log ends before the anchor at sequence %d", anchor.Sequence)
+	}
+	return verification, err
+}
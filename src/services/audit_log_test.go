@@ -0,0 +1,135 @@
+package service
+
+import (
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"testing"
+)
+
+// tamperedAudit alters the record with sequence tamper as it is read and
+// counts the records handed out.
+// auditConfig keys the chain with chainKey.
+func auditConfig(chainKey string) *config.Config {
+	return &config.Config{Audit: config.AuditConfig{ChainKey: chainKey}}
+}
+
+type tamperedAudit struct {
+	repository.AuditRepository
+	tamper int64
+	read   int
+}
+
+func (t *tamperedAudit) IterateRecords(fn func(models.AuditRecord) error) error {
+	return t.AuditRepository.IterateRecords(func(record models.AuditRecord) error {
+		t.read++
+		if record.Sequence == t.tamper {
+			record.Target = "session:other"
+		}
+		return fn(record)
+	})
+}
+
+func recordActions(t *testing.T, auditLog AuditLog, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := auditLog.Record("ops", enum.SessionDelete, "session:id", map[string]string{"key": "key"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	for _, chainKey := range []string{"", "chain-key"} {
+		audit := repository.NewMemoryAuditRepository([]byte(chainKey))
+		auditLog := NewAuditLog(auditConfig(chainKey), audit)
+		recordActions(t, auditLog, 5)
+
+		verification, err := auditLog.Verify(AuditAnchor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verification.Valid || verification.Records != 5 || verification.Head.Sequence != 5 {
+			t.Errorf("key %q: verification = %+v, want 5 valid records", chainKey, verification)
+		}
+	}
+}
+
+func TestVerifyRejectsOtherChainKey(t *testing.T) {
+	audit := repository.NewMemoryAuditRepository([]byte("chain-key"))
+	recordActions(t, NewAuditLog(auditConfig("chain-key"), audit), 3)
+
+	for _, chainKey := range []string{"", "other-key"} {
+		verification, err := NewAuditLog(auditConfig(chainKey), audit).Verify(AuditAnchor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verification.Valid || verification.BrokenAt != 1 {
+			t.Errorf("key %q: verification = %+v, want broken at 1", chainKey, verification)
+		}
+	}
+}
+
+func TestVerifyAnchor(t *testing.T) {
+	audit := repository.NewMemoryAuditRepository([]byte("chain-key"))
+	auditLog := NewAuditLog(auditConfig("chain-key"), audit)
+	recordActions(t, auditLog, 5)
+	verification, err := auditLog.Verify(AuditAnchor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := verification.Head
+
+	recordActions(t, auditLog, 2)
+	if verification, err := auditLog.Verify(head); err != nil || !verification.Valid {
+		t.Errorf("grown log: verification = %+v, %v, want valid", verification, err)
+	}
+
+	truncated := repository.NewMemoryAuditRepository([]byte("chain-key"))
+	recordActions(t, NewAuditLog(auditConfig("chain-key"), truncated), 3)
+	verification, err = NewAuditLog(auditConfig("chain-key"), truncated).Verify(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid || verification.BrokenAt != 4 {
+		t.Errorf("truncated log: verification = %+v, want broken at 4", verification)
+	}
+
+	verification, err = auditLog.Verify(AuditAnchor{Sequence: head.Sequence, Hash: "rewritten"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid || verification.BrokenAt != head.Sequence || verification.Reason != "hash does not match the anchor" {
+		t.Errorf("rewritten log: verification = %+v, want broken at the anchor", verification)
+	}
+}
+
+func TestParseAuditAnchor(t *testing.T) {
+	anchor, err := ParseAuditAnchor("12:abc")
+	if err != nil || anchor != (AuditAnchor{Sequence: 12, Hash: "abc"}) {
+		t.Errorf("ParseAuditAnchor = %+v, %v", anchor, err)
+	}
+	for _, value := range []string{"12", "12:", "x:abc", "0:abc", "-1:abc"} {
+		if _, err := ParseAuditAnchor(value); err == nil {
+			t.Errorf("ParseAuditAnchor(%q) accepted", value)
+		}
+	}
+}
+
+func TestVerifyStopsAtFirstBreak(t *testing.T) {
+	audit := &tamperedAudit{AuditRepository: repository.NewMemoryAuditRepository(nil), tamper: 3}
+	auditLog := NewAuditLog(auditConfig(""), audit)
+	recordActions(t, auditLog, 10)
+
+	verification, err := auditLog.Verify(AuditAnchor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid || verification.BrokenAt != 3 || verification.Reason != "hash does not match the record content" {
+		t.Errorf("verification = %+v, want broken at 3 by its hash", verification)
+	}
+	if audit.read != 3 {
+		t.Errorf("read %d records, want Verify to stop after 3", audit.read)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+)
+
+// DeletionReport summarizes the erasure of one data subject. Held lists the
+// sessions kept because they are on legal hold.
+type DeletionReport struct {
+	Matched int      `json:"matched"`
+	Deleted int64    `json:"deleted"`
+	Failed  []string `json:"failed"`
+	Held    []string `json:"held"`
+}
+
+// DataSubjectService erases everything stored about one app install.
+type DataSubjectService interface {
+	Filter(installID string, key string) repository.SessionFilter
+	Delete(installID string, key string) (DeletionReport, error)
+}
+
+type dataSubjectService struct {
+	sessionRepository repository.SessionRepository
+	videoService      VideoService
+	devicePrivacy     DevicePrivacy
+}
+
+func NewDataSubjectService(sessionRepository repository.SessionRepository, videoService VideoService, devicePrivacy DevicePrivacy) DataSubjectService {
+	return &dataSubjectService{
+		sessionRepository: sessionRepository,
+		videoService:      videoService,
+		devicePrivacy:     devicePrivacy,
+	}
+}
+
+// Filter matches the sessions of installID whether it was stored raw or
+// pseudonymized, within the project of key or across all projects.
+func (d *dataSubjectService) Filter(installID string, key string) repository.SessionFilter {
+	return repository.SessionFilter{Key: key, InstallIDs: d.devicePrivacy.InstallIDCandidates(key, installID)}
+}
+
+// Delete removes the sessions of installID, within the project of key or
+// across all projects when key is empty. Sessions on legal hold are kept,
+// video included, and reported as held. Otididae deletes the video of each
+// session first; sessions whose video could not be deleted are kept and
+// reported as failed so that the request can be retried. Deleting the video
+// also cancels a queued render, and a render already dispatched has its video
+// deleted once the renderer returns. Otididae is asked to delete a video it is
+// still rendering; should it finish the render anyway, the video it reports
+// matches no session and is deleted on arrival.
+func (d *dataSubjectService) Delete(installID string, key string) (DeletionReport, error) {
+	report := DeletionReport{Failed: make([]string, 0), Held: make([]string, 0)}
+	if installID == "" {
+		return report, errors.New("installID cannot be empty")
+	}
+
+	var deletable []string
+	err := d.sessionRepository.IterateSessions(d.Filter(installID, key), func(session models.Session) error {
+		report.Matched++
+		if session.LegalHold {
+			report.Held = append(report.Held, session.ID)
+			return nil
+		}
+		if err := d.videoService.DeleteVideo(session.Key, session.ID); err != nil {
+			log.Printf("Failed to delete video of session %s: %v", session.ID, err)
+			report.Failed = append(report.Failed, session.ID)
+			return nil
+		}
+		deletable = append(deletable, session.ID)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if len(deletable) > 0 {
+		if report.Deleted, err = d.sessionRepository.DeleteSessionsByID(deletable); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"slices"
+	"testing"
+)
+
+func TestDeleteSubjectKeepsHeldSessions(t *testing.T) {
+	repo := repository.NewMemorySessionRepository(nil)
+	for _, session := range []models.Session{
+		{ID: "free", Key: "key", Device: models.Device{InstallID: "install"}},
+		{ID: "held", Key: "key", Device: models.Device{InstallID: "install"}, LegalHold: true},
+		{ID: "other", Key: "key", Device: models.Device{InstallID: "someone-else"}},
+	} {
+		if err := repo.SaveActionsToMongo(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	videos := &deletedVideos{}
+	dataSubject := NewDataSubjectService(repo, videos, NewDevicePrivacy(&config.Config{}))
+	report, err := dataSubject.Delete("install", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 2 || report.Deleted != 1 || !slices.Equal(report.Held, []string{"held"}) {
+		t.Errorf("report = %+v, want free deleted and held kept", report)
+	}
+	if !slices.Equal(*videos, []string{"free"}) {
+		t.Errorf("deleted videos %v, want only that of free", *videos)
+	}
+	for id, kept := range map[string]bool{"free": false, "held": true, "other": true} {
+		if _, err := repo.FindSessionByID(id, "key"); (err == nil) != kept {
+			t.Errorf("session %s kept = %v, want %v", id, err == nil, kept)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	fieldTotalRAM     = "totalRAM"
+	fieldTotalStorage = "totalStorage"
+	fieldBatteryLevel = "batteryLevel"
+)
+
+var sizePattern = regexp.MustCompile(`^\s*([0-9]+(?:\.[0-9]+)?)\s*([KMGT]?I?B)?\s*$`)
+
+// DevicePrivacy applies the privacy settings of a project to device data.
+type DevicePrivacy interface {
+	Apply(key string, device models.Device) (models.Device, models.PrivacyPolicy, error)
+	InstallIDCandidates(key string, installID string) []string
+}
+
+type devicePrivacy struct {
+	config *config.Config
+}
+
+func NewDevicePrivacy(config *config.Config) DevicePrivacy {
+	return &devicePrivacy{config: config}
+}
+
+// Apply pseudonymizes, drops and coarsens the device fields configured for
+// the project of key. Pseudonyms are stable per project secret, so sessions
+// of one install can still be grouped.
+func (d *devicePrivacy) Apply(key string, device models.Device) (models.Device, models.PrivacyPolicy, error) {
+	privacy := d.config.Project(key).Privacy
+	policy := models.PrivacyPolicy{
+		InstallID: models.InstallIDRaw,
+		Dropped:   make([]string, 0),
+		Coarsened: make([]string, 0),
+	}
+
+	if privacy.PseudonymizeInstallID {
+		if privacy.InstallIDSecret == "" {
+			return device, policy, errors.New("install ID pseudonymization is enabled without a secret")
+		}
+		device.InstallID = pseudonymize(privacy.InstallIDSecret, device.InstallID)
+		policy.InstallID = models.InstallIDPseudonymized
+	}
+
+	for _, field := range privacy.Drop {
+		switch field {
+		case fieldTotalRAM:
+			device.TotalRAM = ""
+		case fieldTotalStorage:
+			device.TotalStorage = ""
+		case fieldBatteryLevel:
+			device.BatteryLevel = 0
+		default:
+			return device, policy, fmt.Errorf("unsupported privacy field %q", field)
+		}
+		policy.Dropped = append(policy.Dropped, field)
+	}
+
+	for _, field := range privacy.Coarsen {
+		switch field {
+		case fieldTotalRAM:
+			device.TotalRAM = coarsenSize(device.TotalRAM)
+		case fieldTotalStorage:
+			device.TotalStorage = coarsenSize(device.TotalStorage)
+		case fieldBatteryLevel:
+			device.BatteryLevel = coarsenBattery(device.BatteryLevel)
+		default:
+			return device, policy, fmt.Errorf("unsupported privacy field %q", field)
+		}
+		policy.Coarsened = append(policy.Coarsened, field)
+	}
+
+	return device, policy, nil
+}
+
+// InstallIDCandidates returns every form installID may be stored under: raw
+// and pseudonymized with the secret of the project of key, or with every
+// configured secret when key is empty.
+func (d *devicePrivacy) InstallIDCandidates(key string, installID string) []string {
+	candidates := []string{installID}
+	add := func(privacy config.PrivacyConfig) {
+		if privacy.InstallIDSecret == "" {
+			return
+		}
+		pseudonym := pseudonymize(privacy.InstallIDSecret, installID)
+		for _, candidate := range candidates {
+			if candidate == pseudonym {
+				return
+			}
+		}
+		candidates = append(candidates, pseudonym)
+	}
+
+	if key != "" {
+		add(d.config.Project(key).Privacy)
+		return candidates
+	}
+	add(d.config.DefaultProject.Privacy)
+	for _, project := range d.config.Projects {
+		add(project.Privacy)
+	}
+	return candidates
+}
+
+func pseudonymize(secret string, installID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(installID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// coarsenSize rounds a size such as "3.7 GB" or a byte count up to the next
+// power of two gigabytes, the way devices are marketed. Unparseable values are dropped.
+func coarsenSize(value string) string {
+	matches := sizePattern.FindStringSubmatch(strings.ToUpper(value))
+	if matches == nil {
+		return ""
+	}
+	amount, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return ""
+	}
+
+	gigabytes := amount
+	switch strings.TrimSuffix(strings.ReplaceAll(matches[2], "I", ""), "B") {
+	case "":
+		gigabytes = amount / (1 << 30)
+	case "K":
+		gigabytes = amount / (1 << 20)
+	case "M":
+		gigabytes = amount / (1 << 10)
+	case "T":
+		gigabytes = amount * (1 << 10)
+	}
+	if gigabytes <= 1 {
+		return "1 GB"
+	}
+	return fmt.Sprintf("%.0f GB", math.Pow(2, math.Ceil(math.Log2(gigabytes))))
+}
+
+// coarsenBattery rounds the level to the nearest 25%, keeping its scale.
+func coarsenBattery(level float64) float64 {
+	if level <= 1 {
+		return math.Round(level*4) / 4
+	}
+	return math.Round(level/25) * 25
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// privacyConfig gives the default project and the projects "a" and "b" the
+// install ID secrets of the same name.
+func privacyConfig(privacy config.PrivacyConfig) *config.Config {
+	project := func(key string) config.ProjectConfig {
+		return config.ProjectConfig{Key: key, Privacy: config.PrivacyConfig{PseudonymizeInstallID: true, InstallIDSecret: "secret-" + key}}
+	}
+	return &config.Config{
+		DefaultProject: config.ProjectConfig{Privacy: privacy},
+		Projects:       []config.ProjectConfig{project("a"), project("b")},
+	}
+}
+
+func TestPseudonymsStablePerProject(t *testing.T) {
+	privacy := NewDevicePrivacy(privacyConfig(config.PrivacyConfig{}))
+	pseudonym := func(key string) string {
+		t.Helper()
+		device, policy, err := privacy.Apply(key, models.Device{InstallID: "install"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.InstallID != models.InstallIDPseudonymized {
+			t.Errorf("project %s: install ID policy %q", key, policy.InstallID)
+		}
+		return device.InstallID
+	}
+
+	first := pseudonym("a")
+	if first == "install" || first != pseudonym("a") {
+		t.Errorf("pseudonym %q is not stable or not pseudonymized", first)
+	}
+	if first == pseudonym("b") {
+		t.Error("projects with different secrets share a pseudonym")
+	}
+	if first != pseudonymize("secret-a", "install") {
+		t.Errorf("pseudonym %q is not keyed with the project secret", first)
+	}
+}
+
+func TestPseudonymizationNeedsSecret(t *testing.T) {
+	privacy := NewDevicePrivacy(privacyConfig(config.PrivacyConfig{PseudonymizeInstallID: true}))
+	if _, _, err := privacy.Apply("other", models.Device{InstallID: "install"}); err == nil {
+		t.Error("pseudonymized without a secret")
+	}
+}
+
+func TestDropAndCoarsenDeviceFields(t *testing.T) {
+	privacy := NewDevicePrivacy(privacyConfig(config.PrivacyConfig{
+		Drop:    []string{fieldTotalStorage},
+		Coarsen: []string{fieldTotalRAM, fieldBatteryLevel},
+	}))
+	device, policy, err := privacy.Apply("other", models.Device{InstallID: "install", TotalRAM: "5.5 GB", TotalStorage: "128 GB", BatteryLevel: 0.61})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := models.Device{InstallID: "install", TotalRAM: "8 GB", BatteryLevel: 0.5}
+	if device != want {
+		t.Errorf("device = %+v, want %+v", device, want)
+	}
+	wantPolicy := models.PrivacyPolicy{InstallID: models.InstallIDRaw, Dropped: []string{fieldTotalStorage}, Coarsened: []string{fieldTotalRAM, fieldBatteryLevel}}
+	if !reflect.DeepEqual(policy, wantPolicy) {
+		t.Errorf("policy = %+v, want %+v", policy, wantPolicy)
+	}
+}
+
+func TestUnsupportedPrivacyField(t *testing.T) {
+	for _, privacy := range []config.PrivacyConfig{{Drop: []string{"model"}}, {Coarsen: []string{"model"}}} {
+		if _, _, err := NewDevicePrivacy(privacyConfig(privacy)).Apply("other", models.Device{}); err == nil {
+			t.Errorf("privacy %+v accepted", privacy)
+		}
+	}
+}
+
+func TestCoarsening(t *testing.T) {
+	for value, want := range map[string]string{
+		"3.7 GB":     "4 GB",
+		"4 GB":       "4 GB",
+		"512 MB":     "1 GB",
+		"6144 MiB":   "8 GB",
+		"1.5 TB":     "2048 GB",
+		"8589934592": "8 GB",
+		"lots":       "",
+	} {
+		if got := coarsenSize(value); got != want {
+			t.Errorf("coarsenSize(%q) = %q, want %q", value, got, want)
+		}
+	}
+	for level, want := range map[float64]float64{0.1: 0, 0.13: 0.25, 0.9: 1, 61: 50, 88: 100} {
+		if got := coarsenBattery(level); got != want {
+			t.Errorf("coarsenBattery(%v) = %v, want %v", level, got, want)
+		}
+	}
+}
+
+func TestInstallIDCandidates(t *testing.T) {
+	privacy := NewDevicePrivacy(privacyConfig(config.PrivacyConfig{InstallIDSecret: "secret-a"}))
+	a, b := pseudonymize("secret-a", "install"), pseudonymize("secret-b", "install")
+
+	for key, want := range map[string][]string{
+		"a":     {"install", a},
+		"b":     {"install", b},
+		"other": {"install", a},
+		"":      {"install", a, b},
+	} {
+		if got := privacy.InstallIDCandidates(key, "install"); !slices.Equal(got, want) {
+			t.Errorf("InstallIDCandidates(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
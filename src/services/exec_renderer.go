@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxCommandOutput is how much of the output of a failed render command is
+// kept in its error.
+const maxCommandOutput = 2048
+
+// execRenderer runs a local command, such as an ffmpeg script, on the
+// spooled recording. The command reads its inputs from environment
+// variables:
+//
+//	NYMPHICUS_SESSION_ID  the session ID
+//	NYMPHICUS_INPUT       the recording
+//	NYMPHICUS_TIMELINES   a file holding the gesture timelines, as JSON
+//	NYMPHICUS_MASKS       a file holding the masked segments, as a JSON array
+//	NYMPHICUS_DURATION    the duration in milliseconds
+//	NYMPHICUS_OUTPUT      where to write the video
+//
+// The video is then served from VideoBaseURL and the session completed.
+type execRenderer struct {
+	config            config.RendererConfig
+	sessionRepository repository.SessionRepository
+}
+
+// Render runs the command and waits for it, up to Timeout seconds, then
+// completes the session with the video. A failed command is returned for the
+// scheduler to mark the session Error.
+func (r *execRenderer) Render(job RenderJob) error {
+	videoURL, err := r.run(job)
+	if err != nil {
+		return err
+	}
+	return r.sessionRepository.CompleteRender(job.SessionID, &videoURL)
+}
+
+// Delete removes the video of the session from OutputDir.
+func (r *execRenderer) Delete(sessionId string) error {
+	if strings.ContainsAny(sessionId, `/\`) {
+		return fmt.Errorf("invalid session ID %q", sessionId)
+	}
+	videos, err := filepath.Glob(filepath.Join(r.config.OutputDir, sessionId+".*"))
+	if err != nil {
+		return err
+	}
+	for _, video := range videos {
+		if err := os.Remove(video); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *execRenderer) run(job RenderJob) (string, error) {
+	if strings.ContainsAny(job.SessionID, `/\`) {
+		return "", fmt.Errorf("invalid session ID %q", job.SessionID)
+	}
+	spool, err := os.MkdirTemp(r.config.SpoolDir, job.SessionID+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(spool)
+
+	timeLines := filepath.Join(spool, "timelines.json")
+	if err := writeJSONFile(timeLines, job.TimeLines); err != nil {
+		return "", err
+	}
+	segments := job.Masks
+	if segments == nil {
+		segments = make([]models.MaskedSegment, 0)
+	}
+	masks := filepath.Join(spool, "masks.json")
+	if err := writeJSONFile(masks, segments); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(r.config.OutputDir, 0o755); err != nil {
+		return "", err
+	}
+	name := job.SessionID + ".mp4"
+	output := filepath.Join(r.config.OutputDir, name)
+
+	timeout := r.config.Timeout * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.config.Command[0], r.config.Command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"NYMPHICUS_SESSION_ID="+job.SessionID,
+		"NYMPHICUS_INPUT="+job.Recording,
+		"NYMPHICUS_TIMELINES="+timeLines,
+		"NYMPHICUS_MASKS="+masks,
+		"NYMPHICUS_DURATION="+job.Duration,
+		"NYMPHICUS_OUTPUT="+output,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if len(out) > maxCommandOutput {
+			out = out[len(out)-maxCommandOutput:]
+		}
+		return "", fmt.Errorf("render command failed: %v: %s", err, out)
+	}
+	if _, err := os.Stat(output); err != nil {
+		return "", fmt.Errorf("render command wrote no video: %v", err)
+	}
+	return strings.TrimSuffix(r.config.VideoBaseURL, "/") + "/" + name, nil
+}
+
+func writeJSONFile(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestExecRenderer runs script with sh and keeps a session in progress to
+// render.
+func newTestExecRenderer(t *testing.T, script string) (*execRenderer, repository.SessionRepository) {
+	t.Helper()
+	sessions := repository.NewMemorySessionRepository(nil)
+	if err := sessions.SaveActionsToMongo(models.Session{ID: "session", Key: "key", Status: enum.InProgress.String()}); err != nil {
+		t.Fatal(err)
+	}
+	return &execRenderer{
+		config: config.RendererConfig{
+			Backend:      RendererExec,
+			Command:      []string{"sh", "-c", script},
+			SpoolDir:     t.TempDir(),
+			OutputDir:    t.TempDir(),
+			VideoBaseURL: "http://videos/",
+		},
+		sessionRepository: sessions,
+	}, sessions
+}
+
+func TestExecRendererCompletesSession(t *testing.T) {
+	renderer, sessions := newTestExecRenderer(t, `cat "$NYMPHICUS_MASKS" > "$NYMPHICUS_OUTPUT"`)
+	job := RenderJob{Key: "key", SessionID: "session", Masks: []models.MaskedSegment{{Activity: "Login", Mode: models.MaskBlur, Start: 1, End: 2}}}
+	if err := renderer.Render(job); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := sessions.FindSessionByID("session", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != enum.Complete.String() || session.VideoUrl == nil || *session.VideoUrl != "http://videos/session.mp4" {
+		t.Errorf("session %s with video %v, want it complete", session.Status, session.VideoUrl)
+	}
+	video, err := os.ReadFile(filepath.Join(renderer.config.OutputDir, "session.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(video) != `[{"activity":"Login","activityIndex":0,"mode":"blur","start":1,"end":2}]` {
+		t.Errorf("NYMPHICUS_MASKS held %s", video)
+	}
+
+	if err := renderer.Delete("session"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(renderer.config.OutputDir, "session.mp4")); !os.IsNotExist(err) {
+		t.Errorf("video still there after Delete: %v", err)
+	}
+}
+
+func TestExecRendererLeavesFailuresToScheduler(t *testing.T) {
+	for name, script := range map[string]string{
+		"failing command": "exit 3",
+		"no video":        "true",
+	} {
+		renderer, sessions := newTestExecRenderer(t, script)
+		if err := renderer.Render(RenderJob{Key: "key", SessionID: "session"}); err == nil {
+			t.Errorf("%s: rendered", name)
+		}
+		session, err := sessions.FindSessionByID("session", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Status != enum.InProgress.String() {
+			t.Errorf("%s: session %s, want it left in progress", name, session.Status)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+)
+
+const (
+	rageTapMinTaps   = 3
+	rageTapWindow    = 1000 // ms from the first to the last tap
+	rageTapRadius    = 50.0 // px around the first tap
+	thrashMinVisits  = 4    // A -> B -> A -> B
+	thrashWindow     = 10000
+	idleMinGap       = 10000 // ms without any gesture
+	burstMinGestures = 5
+	burstWindow      = 3000
+)
+
+type FrustrationDetector interface {
+	Detect(logs src.ActivityGestureLogs, events []models.GestureEvent) []models.FrustrationSignal
+}
+
+type frustrationDetector struct{}
+
+func NewFrustrationDetector() FrustrationDetector {
+	return &frustrationDetector{}
+}
+
+// Detect looks for rage taps, back-and-forth activity thrashing and idle gaps
+// followed by bursts of gestures. events must be the classification of logs.
+func (f *frustrationDetector) Detect(logs src.ActivityGestureLogs, events []models.GestureEvent) []models.FrustrationSignal {
+	signals := make([]models.FrustrationSignal, 0)
+	signals = append(signals, detectRageTaps(events)...)
+	signals = append(signals, detectThrashing(logs.Visits())...)
+	signals = append(signals, detectIdleBursts(events)...)
+	return signals
+}
+
+// detectRageTaps flags runs of taps on the same activity that land within
+// rageTapRadius of the first one and within rageTapWindow.
+func detectRageTaps(events []models.GestureEvent) []models.FrustrationSignal {
+	var signals []models.FrustrationSignal
+	for i := 0; i < len(events); {
+		first := events[i]
+		if !isTap(first) {
+			i++
+			continue
+		}
+
+		taps, end := tapCount(first), i+1
+		for end < len(events) {
+			next := events[end]
+			if !isTap(next) || next.ActivityIndex != first.ActivityIndex ||
+				next.StartTime-first.StartTime > rageTapWindow ||
+				first.Start.Distance(next.Start) > rageTapRadius {
+				break
+			}
+			taps += tapCount(next)
+			end++
+		}
+
+		if taps >= rageTapMinTaps {
+			signals = append(signals, models.FrustrationSignal{
+				Type:        enum.RageTap.String(),
+				Activity:    first.Activity,
+				StartTime:   first.StartTime,
+				EndTime:     events[end-1].EndTime,
+				Count:       taps,
+				Description: fmt.Sprintf("%d rapid taps on %s", taps, first.Activity),
+			})
+		}
+		i = end
+	}
+	return signals
+}
+
+func isTap(event models.GestureEvent) bool {
+	return event.Type == enum.Tap.String() || event.Type == enum.DoubleTap.String()
+}
+
+func tapCount(event models.GestureEvent) int {
+	if event.Type == enum.DoubleTap.String() {
+		return 2
+	}
+	return 1
+}
+
+// detectThrashing flags alternations between two activities (A, B, A, B, ...)
+// of at least thrashMinVisits visits within thrashWindow.
+func detectThrashing(visits []src.ActivityVisit) []models.FrustrationSignal {
+	var signals []models.FrustrationSignal
+	for i := 0; i+thrashMinVisits <= len(visits); {
+		a, b := visits[i], visits[i+1]
+		if a.Name == b.Name {
+			i++
+			continue
+		}
+
+		end := i + 2
+		for end < len(visits) && visits[end].Name == visits[end-2].Name &&
+			visits[end].Start-a.Start <= thrashWindow {
+			end++
+		}
+
+		if count := end - i; count >= thrashMinVisits {
+			signals = append(signals, models.FrustrationSignal{
+				Type:        enum.ActivityThrashing.String(),
+				Activity:    a.Name,
+				StartTime:   a.Start,
+				EndTime:     visits[end-1].Start,
+				Count:       count,
+				Description: fmt.Sprintf("switched %d times between %s and %s", count-1, a.Name, b.Name),
+			})
+			i = end
+			continue
+		}
+		i++
+	}
+	return signals
+}
+
+// detectIdleBursts flags at least burstMinGestures gestures within burstWindow
+// right after idleMinGap without any gesture. Gestures that could not be
+// classified carry no usable times and are left out.
+func detectIdleBursts(events []models.GestureEvent) []models.FrustrationSignal {
+	var signals []models.FrustrationSignal
+	events = timedEvents(events)
+	for i := 1; i < len(events); i++ {
+		gap := events[i].StartTime - events[i-1].EndTime
+		if gap < idleMinGap {
+			continue
+		}
+
+		end := i
+		for end < len(events) && events[end].StartTime-events[i].StartTime <= burstWindow {
+			end++
+		}
+
+		if count := end - i; count >= burstMinGestures {
+			signals = append(signals, models.FrustrationSignal{
+				Type:        enum.IdleBurst.String(),
+				Activity:    events[i].Activity,
+				StartTime:   events[i].StartTime,
+				EndTime:     events[end-1].EndTime,
+				Count:       count,
+				Description: fmt.Sprintf("%d gestures on %s after %ds idle", count, events[i].Activity, gap/1000),
+			})
+		}
+	}
+	return signals
+}
+
+// timedEvents returns the classified events that have timestamps.
+func timedEvents(events []models.GestureEvent) []models.GestureEvent {
+	timed := make([]models.GestureEvent, 0, len(events))
+	for _, event := range events {
+		if isTimed(event) {
+			timed = append(timed, event)
+		}
+	}
+	return timed
+}
+
+// isTimed reports whether event was classified from actions with coordinates
+// and timestamps; the others have zero times.
+func isTimed(event models.GestureEvent) bool {
+	return event.Type != enum.Unknown.String() && (event.StartTime != 0 || event.EndTime != 0)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"testing"
+)
+
+func tapAt(start int64, x float64) models.GestureEvent {
+	return models.GestureEvent{
+		Type:      enum.Tap.String(),
+		Activity:  "MainActivity",
+		StartTime: start,
+		EndTime:   start + 50,
+		Start:     src.Point{X: x, Y: 100},
+		End:       src.Point{X: x, Y: 100},
+	}
+}
+
+func unparsed() models.GestureEvent {
+	return models.GestureEvent{Type: enum.Unknown.String(), Activity: "MainActivity"}
+}
+
+func signalsOf(signals []models.FrustrationSignal, signalType enum.FrustrationSignal) []models.FrustrationSignal {
+	var matching []models.FrustrationSignal
+	for _, signal := range signals {
+		if signal.Type == signalType.String() {
+			matching = append(matching, signal)
+		}
+	}
+	return matching
+}
+
+func TestDetectRageTaps(t *testing.T) {
+	base := int64(1_700_000_000_000)
+	events := []models.GestureEvent{tapAt(base, 100), tapAt(base+200, 110), tapAt(base+400, 105), tapAt(base+5000, 100)}
+
+	signals := detectRageTaps(events)
+	if len(signals) != 1 || signals[0].Count != 3 || signals[0].StartTime != base {
+		t.Fatalf("rage taps = %+v, want one of 3 taps", signals)
+	}
+
+	// Taps far apart on screen are not one rage tap.
+	events = []models.GestureEvent{tapAt(base, 100), tapAt(base+200, 400), tapAt(base+400, 700)}
+	if signals := detectRageTaps(events); len(signals) != 0 {
+		t.Errorf("rage taps on spread taps = %+v, want none", signals)
+	}
+}
+
+func TestDetectThrashing(t *testing.T) {
+	visit := func(name string, at int64) src.ActivityVisit {
+		return src.ActivityVisit{Name: name, Start: at, End: at + 500}
+	}
+	visits := []src.ActivityVisit{visit("A", 0), visit("B", 1000), visit("A", 2000), visit("B", 3000), visit("C", 4000)}
+
+	signals := detectThrashing(visits)
+	if len(signals) != 1 || signals[0].Count != 4 || signals[0].Activity != "A" {
+		t.Fatalf("thrashing = %+v, want one of 4 visits", signals)
+	}
+	if signals := detectThrashing(visits[:3]); len(signals) != 0 {
+		t.Errorf("thrashing over 3 visits = %+v, want none", signals)
+	}
+}
+
+func TestDetectIdleBursts(t *testing.T) {
+	base := int64(1_700_000_000_000)
+	events := []models.GestureEvent{tapAt(base, 100)}
+	for i := int64(0); i < burstMinGestures; i++ {
+		events = append(events, tapAt(base+idleMinGap+500+i*300, float64(100+i*200)))
+	}
+
+	signals := detectIdleBursts(events)
+	if len(signals) != 1 || signals[0].Count != burstMinGestures {
+		t.Fatalf("idle bursts = %+v, want one of %d gestures", signals, burstMinGestures)
+	}
+}
+
+// Gestures that failed to parse have zero times; measuring gaps from them
+// would find an idle period as long as the epoch.
+func TestDetectIdleBurstsIgnoresUnparsedGestures(t *testing.T) {
+	base := int64(1_700_000_000_000)
+	events := []models.GestureEvent{unparsed()}
+	for i := int64(0); i < burstMinGestures; i++ {
+		events = append(events, tapAt(base+i*300, float64(100+i*200)))
+	}
+	events = append(events, unparsed(), tapAt(base+2000, 100))
+
+	if signals := detectIdleBursts(events); len(signals) != 0 {
+		t.Errorf("idle bursts = %+v, want none", signals)
+	}
+}
+
+func TestDetectCombinesDetectors(t *testing.T) {
+	base := int64(1_700_000_000_000)
+	events := []models.GestureEvent{unparsed(), tapAt(base, 100), tapAt(base+200, 100), tapAt(base+400, 100)}
+
+	signals := NewFrustrationDetector().Detect(src.ActivityGestureLogs{}, events)
+	if len(signalsOf(signals, enum.RageTap)) != 1 || len(signalsOf(signals, enum.IdleBurst)) != 0 {
+		t.Errorf("signals = %+v, want a single rage tap", signals)
+	}
+}
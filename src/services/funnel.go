@@ -0,0 +1,146 @@
+package service
+
+import (
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+)
+
+const funnelExampleSessions = 5
+
+// FunnelStepDefinition is one activity of a funnel. MaxGap, in milliseconds,
+// bounds the time since the previous step; zero means unbounded.
+type FunnelStepDefinition struct {
+	Activity string
+	MaxGap   int64
+}
+
+// FunnelBuilder matches sessions against an ordered list of activities.
+type FunnelBuilder interface {
+	Add(sessionID string, logs src.ActivityGestureLogs)
+	Build() models.Funnel
+}
+
+type funnelBuilder struct {
+	definitions []FunnelStepDefinition
+	sessions    int
+	reached     []int
+	durations   [][]int64
+	examples    [][]string
+	dropOffs    [][]string
+}
+
+func NewFunnelBuilder(definitions []FunnelStepDefinition) FunnelBuilder {
+	return &funnelBuilder{
+		definitions: definitions,
+		reached:     make([]int, len(definitions)),
+		durations:   make([][]int64, len(definitions)),
+		examples:    make([][]string, len(definitions)),
+		dropOffs:    make([][]string, len(definitions)),
+	}
+}
+
+func (b *funnelBuilder) Add(sessionID string, logs src.ActivityGestureLogs) {
+	b.sessions++
+
+	depth, times := b.match(logs.Visits())
+	for step := 0; step < depth; step++ {
+		b.reached[step]++
+		if step > 0 {
+			b.durations[step] = append(b.durations[step], times[step]-times[step-1])
+		}
+		if len(b.examples[step]) < funnelExampleSessions {
+			b.examples[step] = append(b.examples[step], sessionID)
+		}
+	}
+	if depth < len(b.definitions) && len(b.dropOffs[depth]) < funnelExampleSessions {
+		b.dropOffs[depth] = append(b.dropOffs[depth], sessionID)
+	}
+}
+
+// match returns how many steps the visits complete and the start time of each
+// completed step. Every occurrence of the first step is tried, keeping the
+// deepest path, since an early occurrence can miss a gap a later one meets.
+func (b *funnelBuilder) match(visits []src.ActivityVisit) (int, []int64) {
+	if len(b.definitions) == 0 {
+		return 0, nil
+	}
+
+	var bestDepth int
+	var bestTimes []int64
+	for start, visit := range visits {
+		if visit.Name != b.definitions[0].Activity {
+			continue
+		}
+
+		times := []int64{visit.Start}
+		position := start
+		for step := 1; step < len(b.definitions); step++ {
+			next := b.nextVisit(visits, position, step, times[step-1])
+			if next < 0 {
+				break
+			}
+			times = append(times, visits[next].Start)
+			position = next
+		}
+
+		if len(times) > bestDepth {
+			bestDepth, bestTimes = len(times), times
+		}
+		if bestDepth == len(b.definitions) {
+			break
+		}
+	}
+	return bestDepth, bestTimes
+}
+
+// nextVisit finds the first visit after position matching step within its gap.
+func (b *funnelBuilder) nextVisit(visits []src.ActivityVisit, position int, step int, previous int64) int {
+	definition := b.definitions[step]
+	for i := position + 1; i < len(visits); i++ {
+		if definition.MaxGap > 0 && visits[i].Start-previous > definition.MaxGap {
+			return -1
+		}
+		if visits[i].Name == definition.Activity {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *funnelBuilder) Build() models.Funnel {
+	funnel := models.Funnel{
+		Sessions: b.sessions,
+		Steps:    make([]models.FunnelStep, len(b.definitions)),
+	}
+
+	previous := b.sessions
+	for i, definition := range b.definitions {
+		funnel.Steps[i] = models.FunnelStep{
+			Activity:          definition.Activity,
+			MaxGap:            definition.MaxGap,
+			Sessions:          b.reached[i],
+			Conversion:        ratio(b.reached[i], previous),
+			OverallConversion: ratio(b.reached[i], b.sessions),
+			DropOff:           previous - b.reached[i],
+			MedianTime:        median(b.durations[i]),
+			ExampleSessionIDs: nonNil(b.examples[i]),
+			DropOffSessionIDs: nonNil(b.dropOffs[i]),
+		}
+		previous = b.reached[i]
+	}
+	return funnel
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var checkout = []FunnelStepDefinition{{Activity: "Home"}, {Activity: "Cart"}, {Activity: "Pay", MaxGap: 2000}}
+
+func TestFunnelSteps(t *testing.T) {
+	builder := NewFunnelBuilder(checkout)
+	builder.Add("complete", logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}}, screen{"Pay", []int64{2000}}))
+	builder.Add("too-slow", logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}}, screen{"Pay", []int64{5000}}))
+	builder.Add("second-try", logsOf(
+		screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}},
+		screen{"Home", []int64{6000}}, screen{"Cart", []int64{7000}}, screen{"Pay", []int64{9000}},
+	))
+	builder.Add("bounced", logsOf(screen{"Cart", []int64{0}}))
+	funnel := builder.Build()
+
+	if funnel.Sessions != 4 {
+		t.Errorf("sessions = %d, want 4", funnel.Sessions)
+	}
+	for i, want := range []struct {
+		sessions, dropOff int
+		conversion        float64
+		medianTime        int64
+		examples, dropped []string
+	}{
+		{3, 1, 0.75, 0, []string{"complete", "too-slow", "second-try"}, []string{"bounced"}},
+		{3, 0, 1, 1000, []string{"complete", "too-slow", "second-try"}, []string{}},
+		{2, 1, 2.0 / 3, 1500, []string{"complete", "second-try"}, []string{"too-slow"}},
+	} {
+		step := funnel.Steps[i]
+		if step.Sessions != want.sessions || step.DropOff != want.dropOff || step.Conversion != want.conversion || step.MedianTime != want.medianTime {
+			t.Errorf("step %s = %+v, want %+v", step.Activity, step, want)
+		}
+		if !reflect.DeepEqual(step.ExampleSessionIDs, want.examples) || !reflect.DeepEqual(step.DropOffSessionIDs, want.dropped) {
+			t.Errorf("step %s examples %v and drop-offs %v, want %v and %v", step.Activity, step.ExampleSessionIDs, step.DropOffSessionIDs, want.examples, want.dropped)
+		}
+	}
+	if pay := funnel.Steps[2]; pay.OverallConversion != 0.5 || pay.MaxGap != 2000 {
+		t.Errorf("Pay = %+v, want half of all sessions within 2000 ms", pay)
+	}
+}
+
+func TestFunnelGapStopsAtAnyLateVisit(t *testing.T) {
+	builder := NewFunnelBuilder(checkout)
+	// Settings comes after the gap already ran out, so Pay is out of reach.
+	builder.Add("detour", logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}}, screen{"Settings", []int64{4000}}, screen{"Pay", []int64{4500}}))
+	builder.Add("quick-detour", logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}}, screen{"Settings", []int64{1500}}, screen{"Pay", []int64{2500}}))
+	funnel := builder.Build()
+
+	if pay := funnel.Steps[2]; pay.Sessions != 1 || !reflect.DeepEqual(pay.ExampleSessionIDs, []string{"quick-detour"}) {
+		t.Errorf("Pay = %+v, want only quick-detour", pay)
+	}
+}
+
+func TestFunnelSamplesExampleSessions(t *testing.T) {
+	builder := NewFunnelBuilder(checkout[:1])
+	for i := 0; i < 2*funnelExampleSessions; i++ {
+		builder.Add(fmt.Sprint("home-", i), logsOf(screen{"Home", []int64{0}}))
+		builder.Add(fmt.Sprint("away-", i), logsOf(screen{"Cart", []int64{0}}))
+	}
+	home := builder.Build().Steps[0]
+
+	if home.Sessions != 2*funnelExampleSessions || home.DropOff != 2*funnelExampleSessions {
+		t.Errorf("Home = %+v, want every session counted", home)
+	}
+	if len(home.ExampleSessionIDs) != funnelExampleSessions || home.ExampleSessionIDs[0] != "home-0" {
+		t.Errorf("examples = %v, want the first %d", home.ExampleSessionIDs, funnelExampleSessions)
+	}
+	if len(home.DropOffSessionIDs) != funnelExampleSessions || home.DropOffSessionIDs[0] != "away-0" {
+		t.Errorf("drop-offs = %v, want the first %d", home.DropOffSessionIDs, funnelExampleSessions)
+	}
+}
+
+func TestFunnelWithoutSessions(t *testing.T) {
+	funnel := NewFunnelBuilder(checkout).Build()
+	for _, step := range funnel.Steps {
+		if step.Sessions != 0 || step.Conversion != 0 || step.ExampleSessionIDs == nil || step.DropOffSessionIDs == nil {
+			t.Errorf("step %+v, want empty", step)
+		}
+	}
+}
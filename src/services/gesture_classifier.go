@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+)
+
+const (
+	tapSlop            = 20.0  // px a finger may drift and still count as a tap
+	longPressTimeout   = 500   // ms
+	doubleTapTimeout   = 300   // ms between the end of one tap and the start of the next
+	doubleTapSlop      = 100.0 // px between two taps of a double-tap
+	flingMinVelocity   = 1.5   // px/ms
+	swipeMinVelocity   = 0.3   // px/ms
+	pinchMinScaleDelta = 0.1
+)
+
+type GestureClassifier interface {
+	Classify(logs src.ActivityGestureLogs) []models.GestureEvent
+}
+
+type gestureClassifier struct{}
+
+func NewGestureClassifier() GestureClassifier {
+	return &gestureClassifier{}
+}
+
+// Classify turns every gesture of every activity into a semantic event.
+// Consecutive taps close in time and space are merged into a double-tap.
+func (g *gestureClassifier) Classify(logs src.ActivityGestureLogs) []models.GestureEvent {
+	events := make([]models.GestureEvent, 0)
+	for activityIndex, activity := range logs.Activities {
+		var previous *models.GestureEvent
+		for gestureIndex, gesture := range activity.Gestures {
+			event := classifyGesture(gesture)
+			event.Activity = activity.ActivityName
+			event.ActivityIndex = activityIndex
+			event.GestureIndex = gestureIndex
+
+			if previous != nil && isDoubleTap(*previous, event) {
+				previous.Type = enum.DoubleTap.String()
+				previous.EndTime = event.EndTime
+				previous.End = event.End
+				previous.Description = describeEvent(*previous)
+				previous = nil
+				continue
+			}
+
+			event.Description = describeEvent(event)
+			events = append(events, event)
+			previous = &events[len(events)-1]
+		}
+	}
+	return events
+}
+
+// touchSample is a parsed action with its timestamp and pointer positions.
+type touchSample struct {
+	time   int64
+	points []src.Point
+}
+
+func classifyGesture(gesture src.Gesture) models.GestureEvent {
+	event := models.GestureEvent{Type: enum.Unknown.String()}
+
+	samples := parseSamples(gesture)
+	if len(samples) == 0 {
+		return event
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	event.StartTime = first.time
+	event.EndTime = last.time
+	event.Start = first.points[0]
+	event.End = last.points[0]
+
+	if scale, ok := pinchScale(samples); ok {
+		if math.Abs(scale-1) >= pinchMinScaleDelta {
+			event.Type = enum.Pinch.String()
+			event.Scale = scale
+			if scale > 1 {
+				event.Direction = "out"
+			} else {
+				event.Direction = "in"
+			}
+			return event
+		}
+		event.Type = enum.Scroll.String()
+		event.Direction = direction(event.Start, event.End)
+		return event
+	}
+
+	duration := event.EndTime - event.StartTime
+	distance := event.Start.Distance(event.End)
+
+	if distance < tapSlop {
+		if duration >= longPressTimeout {
+			event.Type = enum.LongPress.String()
+		} else {
+			event.Type = enum.Tap.String()
+		}
+		return event
+	}
+
+	event.Direction = direction(event.Start, event.End)
+	if duration > 0 {
+		event.Velocity = distance / float64(duration)
+	} else {
+		event.Velocity = math.Inf(1)
+	}
+
+	switch {
+	case event.Velocity >= flingMinVelocity:
+		event.Type = enum.Fling.String()
+	case event.Velocity >= swipeMinVelocity:
+		event.Type = enum.Swipe.String()
+	default:
+		event.Type = enum.Scroll.String()
+	}
+	if math.IsInf(event.Velocity, 1) {
+		event.Velocity = 0
+	}
+	return event
+}
+
+// parseSamples keeps the actions whose time and coordinates can be parsed.
+func parseSamples(gesture src.Gesture) []touchSample {
+	samples := make([]touchSample, 0, len(gesture.Actions))
+	for _, action := range gesture.Actions {
+		t, err := action.Timestamp()
+		if err != nil {
+			continue
+		}
+		points, err := action.Points()
+		if err != nil || len(points) == 0 {
+			continue
+		}
+		samples = append(samples, touchSample{time: t, points: points})
+	}
+	return samples
+}
+
+// pinchScale returns the ratio between the last and first two-finger span
+// if at least two samples carry two pointers.
+func pinchScale(samples []touchSample) (float64, bool) {
+	var spans []float64
+	for _, sample := range samples {
+		if len(sample.points) >= 2 {
+			spans = append(spans, sample.points[0].Distance(sample.points[1]))
+		}
+	}
+	if len(spans) < 2 || spans[0] == 0 {
+		return 0, false
+	}
+	return spans[len(spans)-1] / spans[0], true
+}
+
+func isDoubleTap(previous, current models.GestureEvent) bool {
+	return previous.Type == enum.Tap.String() &&
+		current.Type == enum.Tap.String() &&
+		current.StartTime-previous.EndTime <= doubleTapTimeout &&
+		current.StartTime >= previous.EndTime &&
+		previous.Start.Distance(current.Start) <= doubleTapSlop
+}
+
+// direction reports the dominant axis of movement in screen coordinates,
+// where y grows downwards.
+func direction(from, to src.Point) string {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	if math.Abs(dx) >= math.Abs(dy) {
+		if dx < 0 {
+			return "left"
+		}
+		return "right"
+	}
+	if dy < 0 {
+		return "up"
+	}
+	return "down"
+}
+
+func describeEvent(event models.GestureEvent) string {
+	if event.Direction != "" {
+		return fmt.Sprintf("%s %s on %s", event.Type, event.Direction, event.Activity)
+	}
+	return fmt.Sprintf("%s on %s", event.Type, event.Activity)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"strconv"
+	"testing"
+)
+
+// touch builds a gesture from (time, coordinates) pairs.
+func touch(samples ...string) src.Gesture {
+	var gesture src.Gesture
+	for i := 0; i+1 < len(samples); i += 2 {
+		action := src.ActionMove
+		switch {
+		case i == 0:
+			action = src.ActionDown
+		case i+2 >= len(samples):
+			action = src.ActionUp
+		}
+		gesture.Actions = append(gesture.Actions, src.Action{Action: action, TargetTime: samples[i], Coordinates: samples[i+1]})
+	}
+	return gesture
+}
+
+func TestClassifyGesture(t *testing.T) {
+	tests := []struct {
+		name      string
+		gesture   src.Gesture
+		want      enum.GestureType
+		direction string
+	}{
+		{"tap", touch("1000", "100,100", "1080", "105,102"), enum.Tap, ""},
+		{"long press", touch("1000", "100,100", "1700", "102,101"), enum.LongPress, ""},
+		{"fling", touch("1000", "500,800", "1100", "500,200"), enum.Fling, "up"},
+		{"swipe", touch("1000", "100,500", "1500", "500,500"), enum.Swipe, "right"},
+		{"scroll", touch("1000", "100,500", "3000", "100,700"), enum.Scroll, "down"},
+		{"pinch", touch("1000", "100,100;200,200", "1200", "50,50;300,300"), enum.Pinch, "out"},
+		{"unparsable", touch("soon", "here", "later", "there"), enum.Unknown, ""},
+	}
+	for _, test := range tests {
+		event := classifyGesture(test.gesture)
+		if event.Type != test.want.String() || event.Direction != test.direction {
+			t.Errorf("%s: classified as %s %q, want %s %q", test.name, event.Type, event.Direction, test.want, test.direction)
+		}
+	}
+}
+
+func TestClassifyMergesDoubleTaps(t *testing.T) {
+	tap := func(at int) src.Gesture {
+		return touch(strconv.Itoa(at), "100,100", strconv.Itoa(at+60), "100,100")
+	}
+	logs := src.ActivityGestureLogs{Activities: []src.ActivityGesture{
+		{ActivityName: "MainActivity", Gestures: []src.Gesture{tap(1000), tap(1200), tap(5000)}},
+		{ActivityName: "DetailActivity", Gestures: []src.Gesture{tap(5200)}},
+	}}
+
+	events := NewGestureClassifier().Classify(logs)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(events), events)
+	}
+	if events[0].Type != enum.DoubleTap.String() || events[0].EndTime != 1260 {
+		t.Errorf("first event = %+v, want a double-tap ending at 1260", events[0])
+	}
+	// Taps on different activities are never merged.
+	if events[1].Type != enum.Tap.String() || events[2].Type != enum.Tap.String() || events[2].ActivityIndex != 1 {
+		t.Errorf("last events = %+v, want two single taps", events[1:])
+	}
+}
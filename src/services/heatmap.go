@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+)
+
+const normalizedResolution = "normalized"
+
+// HeatmapBuilder buckets the taps of one activity into a density grid.
+type HeatmapBuilder interface {
+	Add(device models.Device, events []models.GestureEvent)
+	Build() models.Heatmap
+}
+
+type heatmapBuilder struct {
+	heatmap models.Heatmap
+	width   float64
+	height  float64
+}
+
+// NewHeatmapBuilder creates a builder for activity. An empty resolution
+// normalizes every tap by its device's screen size; otherwise only sessions
+// recorded at that resolution are counted, bucketed in pixels.
+func NewHeatmapBuilder(activity string, resolution string, columns int, rows int) HeatmapBuilder {
+	b := &heatmapBuilder{
+		heatmap: models.Heatmap{
+			Activity:   activity,
+			Resolution: normalizedResolution,
+			Columns:    columns,
+			Rows:       rows,
+			Cells:      make([][]int, rows),
+		},
+	}
+	for row := range b.heatmap.Cells {
+		b.heatmap.Cells[row] = make([]int, columns)
+	}
+	if resolution != "" {
+		b.heatmap.Resolution = resolution
+		b.width, b.height, _ = models.Device{ScreenResolution: resolution}.ScreenSize()
+	}
+	return b
+}
+
+func (b *heatmapBuilder) Add(device models.Device, events []models.GestureEvent) {
+	width, height, ok := device.ScreenSize()
+	if !ok {
+		return
+	}
+	if b.heatmap.Resolution != normalizedResolution && (width != b.width || height != b.height) {
+		return
+	}
+
+	counted := false
+	for _, event := range events {
+		if event.Activity != b.heatmap.Activity || !isTouchPoint(event) {
+			continue
+		}
+		column := int(event.Start.X / width * float64(b.heatmap.Columns))
+		row := int(event.Start.Y / height * float64(b.heatmap.Rows))
+		if column < 0 || column >= b.heatmap.Columns || row < 0 || row >= b.heatmap.Rows {
+			continue
+		}
+
+		b.heatmap.Cells[row][column]++
+		b.heatmap.Taps++
+		if b.heatmap.Cells[row][column] > b.heatmap.Max {
+			b.heatmap.Max = b.heatmap.Cells[row][column]
+		}
+		counted = true
+	}
+	if counted {
+		b.heatmap.Sessions++
+	}
+}
+
+func (b *heatmapBuilder) Build() models.Heatmap {
+	return b.heatmap
+}
+
+// isTouchPoint reports whether the event is a stationary touch worth plotting.
+func isTouchPoint(event models.GestureEvent) bool {
+	return isTap(event) || event.Type == enum.LongPress.String()
+}
+
+// RenderHeatmapPNG draws the grid smoothed and scaled to width x height, from
+// transparent for no taps through blue, green and yellow to red for the hottest cell.
+func RenderHeatmapPNG(heatmap models.Heatmap, width int, height int) ([]byte, error) {
+	density := blur(heatmap.Cells)
+	peak := 0.0
+	for _, row := range density {
+		for _, value := range row {
+			peak = math.Max(peak, value)
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if peak > 0 {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				gx := (float64(x)+0.5)/float64(width)*float64(heatmap.Columns) - 0.5
+				gy := (float64(y)+0.5)/float64(height)*float64(heatmap.Rows) - 0.5
+				img.SetNRGBA(x, y, heatColor(sample(density, gx, gy)/peak))
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// blur smooths the grid with a 5x5 gaussian kernel.
+func blur(cells [][]int) [][]float64 {
+	kernel := [5]float64{1, 4, 6, 4, 1}
+	rows := len(cells)
+	if rows == 0 {
+		return nil
+	}
+	columns := len(cells[0])
+
+	horizontal := make([][]float64, rows)
+	for y := range cells {
+		horizontal[y] = make([]float64, columns)
+		for x := range cells[y] {
+			for k, weight := range kernel {
+				if sx := x + k - 2; sx >= 0 && sx < columns {
+					horizontal[y][x] += weight * float64(cells[y][sx])
+				}
+			}
+		}
+	}
+
+	out := make([][]float64, rows)
+	for y := range out {
+		out[y] = make([]float64, columns)
+		for x := range out[y] {
+			for k, weight := range kernel {
+				if sy := y + k - 2; sy >= 0 && sy < rows {
+					out[y][x] += weight * horizontal[sy][x]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// sample reads the grid at fractional coordinates with bilinear interpolation.
+func sample(grid [][]float64, x float64, y float64) float64 {
+	rows, columns := len(grid), len(grid[0])
+	x = math.Max(0, math.Min(x, float64(columns-1)))
+	y = math.Max(0, math.Min(y, float64(rows-1)))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, columns-1), min(y0+1, rows-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	top := grid[y0][x0]*(1-fx) + grid[y0][x1]*fx
+	bottom := grid[y1][x0]*(1-fx) + grid[y1][x1]*fx
+	return top*(1-fy) + bottom*fy
+}
+
+var heatGradient = []color.NRGBA{
+	{R: 0, G: 0, B: 255, A: 0},
+	{R: 0, G: 0, B: 255, A: 160},
+	{R: 0, G: 255, B: 0, A: 190},
+	{R: 255, G: 255, B: 0, A: 210},
+	{R: 255, G: 0, B: 0, A: 230},
+}
+
+// heatColor maps an intensity in [0, 1] onto heatGradient.
+func heatColor(intensity float64) color.NRGBA {
+	intensity = math.Max(0, math.Min(intensity, 1))
+	position := intensity * float64(len(heatGradient)-1)
+	i := int(position)
+	if i >= len(heatGradient)-1 {
+		return heatGradient[len(heatGradient)-1]
+	}
+	t := position - float64(i)
+	from, to := heatGradient[i], heatGradient[i+1]
+	lerp := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*t) }
+	return color.NRGBA{R: lerp(from.R, to.R), G: lerp(from.G, to.G), B: lerp(from.B, to.B), A: lerp(from.A, to.A)}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"nymphicus-service/enum"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"testing"
+)
+
+var (
+	phone  = models.Device{ScreenResolution: "1000x2000"}
+	tablet = models.Device{ScreenResolution: "2000x4000"}
+)
+
+func eventAt(kind enum.GestureType, activity string, x float64, y float64) models.GestureEvent {
+	return models.GestureEvent{Type: kind.String(), Activity: activity, Start: src.Point{X: x, Y: y}}
+}
+
+// homeHeatmap builds a 10x20 heatmap of Home at resolution from taps on a
+// phone and a tablet landing in the same cell.
+func homeHeatmap(resolution string) models.Heatmap {
+	builder := NewHeatmapBuilder("Home", resolution, 10, 20)
+	builder.Add(phone, []models.GestureEvent{
+		eventAt(enum.Tap, "Home", 150, 250),
+		eventAt(enum.LongPress, "Home", 950, 1950),
+		eventAt(enum.Swipe, "Home", 500, 500),
+		eventAt(enum.Tap, "Cart", 500, 500),
+		eventAt(enum.Tap, "Home", 1000, 100),
+	})
+	builder.Add(tablet, []models.GestureEvent{eventAt(enum.Tap, "Home", 300, 500)})
+	builder.Add(models.Device{}, []models.GestureEvent{eventAt(enum.Tap, "Home", 10, 10)})
+	return builder.Build()
+}
+
+func TestHeatmapNormalizesScreenSizes(t *testing.T) {
+	heatmap := homeHeatmap("")
+
+	if heatmap.Resolution != normalizedResolution || heatmap.Sessions != 2 || heatmap.Taps != 3 || heatmap.Max != 2 {
+		t.Errorf("heatmap = %+v, want 3 taps over 2 sessions", heatmap)
+	}
+	if heatmap.Cells[2][1] != 2 || heatmap.Cells[19][9] != 1 {
+		t.Errorf("cells [2][1] = %d and [19][9] = %d, want 2 and 1", heatmap.Cells[2][1], heatmap.Cells[19][9])
+	}
+}
+
+func TestHeatmapAtResolution(t *testing.T) {
+	heatmap := homeHeatmap("1000x2000")
+
+	if heatmap.Resolution != "1000x2000" || heatmap.Sessions != 1 || heatmap.Taps != 2 || heatmap.Cells[2][1] != 1 {
+		t.Errorf("heatmap = %+v, want only the phone taps", heatmap)
+	}
+}
+
+func TestRenderHeatmapPNG(t *testing.T) {
+	data, err := RenderHeatmapPNG(homeHeatmap(""), 50, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 50 || bounds.Dy() != 100 {
+		t.Fatalf("image is %v, want 50x100", bounds)
+	}
+	// Pixel (7, 12) is the centre of cell [2][1], the hottest one.
+	if hottest := color.NRGBAModel.Convert(img.At(7, 12)).(color.NRGBA); hottest != heatGradient[len(heatGradient)-1] {
+		t.Errorf("hottest pixel %v, want %v", hottest, heatGradient[len(heatGradient)-1])
+	}
+	if _, _, _, alpha := img.At(45, 50).RGBA(); alpha != 0 {
+		t.Errorf("pixel far from any tap has alpha %d, want transparent", alpha)
+	}
+}
+
+func TestRenderEmptyHeatmapPNG(t *testing.T) {
+	data, err := RenderHeatmapPNG(NewHeatmapBuilder("Home", "", 4, 4).Build(), 8, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if _, _, _, alpha := img.At(x, y).RGBA(); alpha != 0 {
+				t.Fatalf("pixel (%d, %d) has alpha %d, want an empty image", x, y, alpha)
+			}
+		}
+	}
+}
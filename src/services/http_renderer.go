@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"nymphicus-service/config"
+	"os"
+	"path/filepath"
+
+	"github.com/valyala/fasthttp"
+)
+
+// httpRenderer posts recordings to the Otididae cluster, which reports the
+// rendered video itself.
+type httpRenderer struct {
+	cluster OtididaeCluster
+}
+
+func (r *httpRenderer) Render(job RenderJob) error {
+	body, contentType, err := createRequestBody(job)
+	if err != nil {
+		return err
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	err = r.cluster.Do(func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error {
+		if endpoint.RenderURL == "" {
+			return errors.New("OtididaeURL cannot be empty")
+		}
+		req.Header.SetMethod("POST")
+		req.Header.SetContentType(contentType)
+		req.SetRequestURI(endpoint.RenderURL)
+		req.SetBody(body.Bytes())
+		return nil
+	}, resp)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Response status code: %d\n", resp.StatusCode())
+	log.Printf("Response body: %s\n", resp.Body())
+
+	if resp.StatusCode() >= fasthttp.StatusMultipleChoices {
+		return fmt.Errorf("otididae render failed with status %d: %s", resp.StatusCode(), resp.Body())
+	}
+	return nil
+}
+
+// Delete asks every Otididae endpoint to delete the video, since any of them
+// may have rendered it, and succeeds once none of them has it any more.
+func (r *httpRenderer) Delete(sessionId string) error {
+	return r.cluster.DoEach(func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error {
+		if endpoint.DeleteURL == "" {
+			return errors.New("OtididaeDeleteURL cannot be empty")
+		}
+		req.Header.SetMethod("DELETE")
+		req.SetRequestURI(endpoint.DeleteURL)
+		req.URI().QueryArgs().Set("sessionId", sessionId)
+		return nil
+	}, func(resp *fasthttp.Response) error {
+		switch resp.StatusCode() {
+		case fasthttp.StatusOK, fasthttp.StatusAccepted, fasthttp.StatusNoContent, fasthttp.StatusNotFound:
+			return nil
+		default:
+			return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode(), resp.Body())
+		}
+	})
+}
+
+func createRequestBody(job RenderJob) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	file, err := os.Open(job.Recording)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func(file *os.File) {
+		if err := file.Close(); err != nil {
+			log.Printf("Error closing file: %v", err)
+		}
+	}(file)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(job.Filename))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return nil, "", err
+	}
+
+	if err = addFormField(writer, "timeLines", job.TimeLines); err != nil {
+		return nil, "", err
+	}
+
+	// Otididae versions without masking support ignore unknown fields, but
+	// only sessions with masks send one.
+	if len(job.Masks) > 0 {
+		if err = addFormField(writer, "maskedSegments", job.Masks); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err = writer.WriteField("sessionId", job.SessionID); err != nil {
+		return nil, "", err
+	}
+
+	if err = writer.WriteField("duration", job.Duration); err != nil {
+		return nil, "", err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, writer.FormDataContentType(), nil
+}
+
+func addFormField(writer *multipart.Writer, fieldName string, value interface{}) error {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return writer.WriteField(fieldName, string(jsonData))
+}
@@ -0,0 +1,13 @@
+package service
+
+// noopRenderer renders nothing, for projects that only replay gestures. Their
+// sessions stay InProgress without a video.
+type noopRenderer struct{}
+
+func (noopRenderer) Render(RenderJob) error {
+	return nil
+}
+
+func (noopRenderer) Delete(string) error {
+	return nil
+}
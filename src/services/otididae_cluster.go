@@ -0,0 +1,332 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nymphicus-service/config"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	BalancingRoundRobin    = "round-robin"
+	BalancingLeastInflight = "least-inflight"
+)
+
+// ErrNoOtididaeEndpoint is returned when every endpoint is unhealthy or has
+// its circuit open.
+var ErrNoOtididaeEndpoint = errors.New("no Otididae endpoint available")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// OtididaeEndpointStatus is the state of one endpoint as seen by the cluster.
+type OtididaeEndpointStatus struct {
+	RenderURL string `json:"renderURL"`
+	Weight    int    `json:"weight"`
+	Healthy   bool   `json:"healthy"`
+	Circuit   string `json:"circuit"`
+	Failures  int    `json:"failures"`
+	Inflight  int    `json:"inflight"`
+}
+
+// OtididaeCluster spreads requests across the Otididae endpoints, skipping
+// the unhealthy ones and those whose circuit breaker is open.
+type OtididaeCluster interface {
+	// Do sends the request build prepares for the selected endpoint. Transport
+	// errors and 5xx responses count as failures of the endpoint; errors of
+	// build do not.
+	Do(build func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error, resp *fasthttp.Response) error
+	// DoEach sends the request build prepares to every endpoint, whatever its
+	// health and circuit, and passes each response to handle. It fails when
+	// any endpoint cannot be reached or handle fails for it.
+	DoEach(build func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error, handle func(resp *fasthttp.Response) error) error
+	// RunHealthChecks probes the endpoints with a HealthURL every
+	// HealthInterval seconds until stop is closed.
+	RunHealthChecks(stop <-chan struct{})
+	Status() []OtididaeEndpointStatus
+}
+
+type otididaeEndpoint struct {
+	config.OtididaeEndpoint
+	healthy  bool
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	inflight int
+	// current is the smooth weighted round-robin counter.
+	current int
+}
+
+type otididaeCluster struct {
+	config    config.OtididaeConfig
+	timeout   time.Duration
+	client    *fasthttp.Client
+	mu        sync.Mutex
+	endpoints []*otididaeEndpoint
+}
+
+// NewOtididaeCluster builds the cluster of Services.Otididae.Endpoints, or of
+// the single OtididaeURL when none are listed. Endpoints start healthy.
+func NewOtididaeCluster(c *config.Config) OtididaeCluster {
+	clusterConfig := c.Services.Otididae
+	endpoints := clusterConfig.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []config.OtididaeEndpoint{{RenderURL: c.Services.OtididaeURL, DeleteURL: c.Services.OtididaeDeleteURL}}
+	}
+
+	requestTimeout := durationOrDefault(clusterConfig.RequestTimeout, 30)
+	cluster := &otididaeCluster{
+		config:  clusterConfig,
+		timeout: requestTimeout,
+		client: &fasthttp.Client{
+			ReadTimeout:        requestTimeout,
+			WriteTimeout:       requestTimeout,
+			MaxConnsPerHost:    clusterConfig.MaxConns,
+			MaxConnWaitTimeout: requestTimeout,
+		},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		cluster.endpoints = append(cluster.endpoints, &otididaeEndpoint{OtididaeEndpoint: endpoint, healthy: true})
+	}
+	return cluster
+}
+
+func (c *otididaeCluster) Do(build func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error, resp *fasthttp.Response) error {
+	endpoint, err := c.acquire()
+	if err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	if err := build(endpoint.OtididaeEndpoint, req); err != nil {
+		c.cancel(endpoint)
+		return err
+	}
+
+	err = c.client.DoTimeout(req, resp, c.timeout)
+	c.release(endpoint, err == nil && resp.StatusCode() < fasthttp.StatusInternalServerError)
+	if err != nil {
+		return fmt.Errorf("otididae %s: %w", req.URI().Host(), err)
+	}
+	return nil
+}
+
+func (c *otididaeCluster) DoEach(build func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error, handle func(resp *fasthttp.Response) error) error {
+	var errs []error
+	for _, endpoint := range c.endpoints {
+		if err := c.doOn(endpoint, build, handle); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *otididaeCluster) doOn(endpoint *otididaeEndpoint, build func(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error, handle func(resp *fasthttp.Response) error) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	if err := build(endpoint.OtididaeEndpoint, req); err != nil {
+		return err
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	c.mu.Lock()
+	endpoint.inflight++
+	c.mu.Unlock()
+	err := c.client.DoTimeout(req, resp, c.timeout)
+	c.release(endpoint, err == nil && resp.StatusCode() < fasthttp.StatusInternalServerError)
+	if err == nil {
+		err = handle(resp)
+	}
+	if err != nil {
+		return fmt.Errorf("otididae %s: %w", req.URI().Host(), err)
+	}
+	return nil
+}
+
+func (c *otididaeCluster) RunHealthChecks(stop <-chan struct{}) {
+	interval := durationOrDefault(c.config.HealthInterval, 10)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, endpoint := range c.endpoints {
+				if endpoint.HealthURL == "" {
+					continue
+				}
+				healthy := c.probe(endpoint.HealthURL)
+				c.mu.Lock()
+				endpoint.healthy = healthy
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (c *otididaeCluster) Status() []OtididaeEndpointStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]OtididaeEndpointStatus, 0, len(c.endpoints))
+	for _, endpoint := range c.endpoints {
+		statuses = append(statuses, OtididaeEndpointStatus{
+			RenderURL: endpoint.RenderURL,
+			Weight:    endpoint.Weight,
+			Healthy:   endpoint.healthy,
+			Circuit:   c.state(endpoint).String(),
+			Failures:  endpoint.failures,
+			Inflight:  endpoint.inflight,
+		})
+	}
+	return statuses
+}
+
+// acquire selects an available endpoint and counts the request as in flight
+// on it. An endpoint whose circuit is half-open takes a single probe request.
+func (c *otididaeCluster) acquire() (*otididaeEndpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var available []*otididaeEndpoint
+	for _, endpoint := range c.endpoints {
+		if !endpoint.healthy {
+			continue
+		}
+		switch c.state(endpoint) {
+		case breakerClosed:
+			available = append(available, endpoint)
+		case breakerHalfOpen:
+			if !endpoint.probing {
+				available = append(available, endpoint)
+			}
+		}
+	}
+	if len(available) == 0 {
+		return nil, ErrNoOtididaeEndpoint
+	}
+
+	var selected *otididaeEndpoint
+	if c.config.Balancing == BalancingLeastInflight {
+		selected = leastInflight(available)
+	} else {
+		selected = smoothWeighted(available)
+	}
+	if c.state(selected) == breakerHalfOpen {
+		selected.probing = true
+	}
+	selected.inflight++
+	return selected, nil
+}
+
+// release records the outcome of a request on endpoint and trips or resets
+// its circuit breaker.
+func (c *otididaeCluster) release(endpoint *otididaeEndpoint, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	endpoint.inflight--
+	endpoint.probing = false
+	if success {
+		endpoint.state, endpoint.failures = breakerClosed, 0
+		return
+	}
+	endpoint.failures++
+	if endpoint.state != breakerClosed || endpoint.failures >= failureThreshold(c.config) {
+		endpoint.state, endpoint.openedAt = breakerOpen, time.Now()
+	}
+}
+
+// cancel forgets a request that was never sent.
+func (c *otididaeCluster) cancel(endpoint *otididaeEndpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	endpoint.inflight--
+	endpoint.probing = false
+}
+
+// state is the circuit state of endpoint, half-open once an open circuit has
+// waited OpenDuration. The caller holds the lock.
+func (c *otididaeCluster) state(endpoint *otididaeEndpoint) breakerState {
+	if endpoint.state == breakerOpen && time.Since(endpoint.openedAt) >= durationOrDefault(c.config.OpenDuration, 30) {
+		endpoint.state = breakerHalfOpen
+	}
+	return endpoint.state
+}
+
+func (c *otididaeCluster) probe(url string) bool {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(url)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	if err := c.client.DoTimeout(req, resp, c.timeout); err != nil {
+		return false
+	}
+	return resp.StatusCode() >= 200 && resp.StatusCode() < 300
+}
+
+// smoothWeighted picks endpoints in proportion to their weight, interleaved
+// rather than in bursts, as nginx does.
+func smoothWeighted(endpoints []*otididaeEndpoint) *otididaeEndpoint {
+	total := 0
+	var selected *otididaeEndpoint
+	for _, endpoint := range endpoints {
+		endpoint.current += endpoint.Weight
+		total += endpoint.Weight
+		if selected == nil || endpoint.current > selected.current {
+			selected = endpoint
+		}
+	}
+	selected.current -= total
+	return selected
+}
+
+// leastInflight picks the endpoint with the fewest requests in flight
+// relative to its weight.
+func leastInflight(endpoints []*otididaeEndpoint) *otididaeEndpoint {
+	selected := endpoints[0]
+	for _, endpoint := range endpoints[1:] {
+		if endpoint.inflight*selected.Weight < selected.inflight*endpoint.Weight {
+			selected = endpoint
+		}
+	}
+	return selected
+}
+
+// durationOrDefault converts a config value in seconds, fallback when unset.
+func durationOrDefault(seconds time.Duration, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		seconds = fallback
+	}
+	return seconds * time.Second
+}
+
+func failureThreshold(c config.OtididaeConfig) int {
+	if c.FailureThreshold <= 0 {
+		return 5
+	}
+	return c.FailureThreshold
+}
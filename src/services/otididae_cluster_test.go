@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"nymphicus-service/config"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// testNode is an Otididae endpoint answering every request with status.
+type testNode struct {
+	url      string
+	status   atomic.Int32
+	requests atomic.Int32
+}
+
+func newTestNode(t *testing.T, status int) *testNode {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &testNode{url: "http://" + listener.Addr().String() + "/"}
+	node.status.Store(int32(status))
+	server := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		node.requests.Add(1)
+		ctx.SetStatusCode(int(node.status.Load()))
+	}}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown() })
+	return node
+}
+
+func newTestCluster(otididae config.OtididaeConfig) *otididaeCluster {
+	return NewOtididaeCluster(&config.Config{Services: config.Services{Otididae: otididae}}).(*otididaeCluster)
+}
+
+func buildGet(endpoint config.OtididaeEndpoint, req *fasthttp.Request) error {
+	req.SetRequestURI(endpoint.RenderURL)
+	return nil
+}
+
+func TestSmoothWeightedSplit(t *testing.T) {
+	heavy, light := newTestNode(t, 200), newTestNode(t, 200)
+	cluster := newTestCluster(config.OtididaeConfig{Endpoints: []config.OtididaeEndpoint{
+		{RenderURL: heavy.url, Weight: 3},
+		{RenderURL: light.url, Weight: 1},
+	}})
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	for i := 0; i < 40; i++ {
+		if err := cluster.Do(buildGet, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if heavy.requests.Load() != 30 || light.requests.Load() != 10 {
+		t.Errorf("split = %d:%d, want 30:10", heavy.requests.Load(), light.requests.Load())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failing, healthy := newTestNode(t, 500), newTestNode(t, 200)
+	cluster := newTestCluster(config.OtididaeConfig{
+		Endpoints:        []config.OtididaeEndpoint{{RenderURL: failing.url}, {RenderURL: healthy.url}},
+		FailureThreshold: 2,
+	})
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	for i := 0; i < 20; i++ {
+		cluster.Do(buildGet, resp)
+	}
+	if got := failing.requests.Load(); got != 2 {
+		t.Fatalf("failing endpoint got %d requests, want 2 before its circuit opened", got)
+	}
+	if state := cluster.Status()[0].Circuit; state != "open" {
+		t.Fatalf("circuit = %s, want open", state)
+	}
+
+	// Once OpenDuration has passed, a single probe goes through and its
+	// success closes the circuit.
+	cluster.endpoints[0].openedAt = time.Now().Add(-time.Hour)
+	failing.status.Store(200)
+	for i := 0; i < 4; i++ {
+		if err := cluster.Do(buildGet, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := failing.requests.Load(); got != 4 {
+		t.Errorf("recovered endpoint got %d requests in total, want 4", got)
+	}
+	if state := cluster.Status()[0].Circuit; state != "closed" {
+		t.Errorf("circuit = %s, want closed", state)
+	}
+}
+
+func TestHalfOpenTakesOneProbe(t *testing.T) {
+	cluster := newTestCluster(config.OtididaeConfig{Endpoints: []config.OtididaeEndpoint{{RenderURL: "http://unused/"}}})
+	endpoint := cluster.endpoints[0]
+	endpoint.state, endpoint.openedAt = breakerOpen, time.Now().Add(-time.Hour)
+
+	if _, err := cluster.acquire(); err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	if _, err := cluster.acquire(); !errors.Is(err, ErrNoOtididaeEndpoint) {
+		t.Errorf("second acquire while probing = %v, want ErrNoOtididaeEndpoint", err)
+	}
+	cluster.release(endpoint, false)
+	if state := cluster.Status()[0].Circuit; state != "open" {
+		t.Errorf("circuit after a failed probe = %s, want open", state)
+	}
+}
+
+func TestDoEachReachesEveryEndpoint(t *testing.T) {
+	nodes := []*testNode{newTestNode(t, 404), newTestNode(t, 204), newTestNode(t, 404)}
+	var endpoints []config.OtididaeEndpoint
+	for _, node := range nodes {
+		endpoints = append(endpoints, config.OtididaeEndpoint{RenderURL: node.url})
+	}
+	cluster := newTestCluster(config.OtididaeConfig{Endpoints: endpoints})
+	ok := func(resp *fasthttp.Response) error {
+		if resp.StatusCode() >= 300 && resp.StatusCode() != 404 {
+			return errors.New("still there")
+		}
+		return nil
+	}
+
+	if err := cluster.DoEach(buildGet, ok); err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range nodes {
+		if node.requests.Load() != 1 {
+			t.Errorf("endpoint %d got %d requests, want 1", i, node.requests.Load())
+		}
+	}
+
+	nodes[2].status.Store(500)
+	if err := cluster.DoEach(buildGet, ok); err == nil {
+		t.Error("DoEach succeeded although an endpoint failed")
+	}
+}
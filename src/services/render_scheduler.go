@@ -0,0 +1,360 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"nymphicus-service/config"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/src/repository"
+	"os"
+	"sync"
+)
+
+const defaultRenderWorkers = 4
+
+// defaultRenderClasses apply when Rendering.Classes is empty.
+var defaultRenderClasses = []config.RenderClass{
+	{Name: "interactive", Weight: 8},
+	{Name: "paid", Weight: 4},
+	{Name: "standard", Weight: 2},
+	{Name: "bulk", Weight: 1},
+}
+
+// RenderQueueStatus is a snapshot of the render queue.
+type RenderQueueStatus struct {
+	Classes []RenderClassStatus `json:"classes"`
+	Running int                 `json:"running"`
+}
+
+type RenderClassStatus struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+	Queued int    `json:"queued"`
+}
+
+// RenderScheduler queues render jobs by priority class and dispatches them to
+// the renderer of their project. Classes share the workers by weighted fair
+// queuing, projects of a class take turns, and no project runs more jobs at
+// once than its MaxConcurrentRenders.
+type RenderScheduler interface {
+	// Priority resolves the class of a render of the project of key. A
+	// request may lower the class of its project, never raise it.
+	Priority(key string, requested string) (string, error)
+	Enqueue(job RenderJob) error
+	// Cancel drops the queued job of a session and reports whether there was
+	// one. The video of a job already dispatched is deleted once it returns.
+	Cancel(sessionId string) bool
+	// Run dispatches jobs until stop is closed, then fails those still queued
+	// and returns without waiting for the ones dispatched.
+	Run(stop <-chan struct{})
+	Status() RenderQueueStatus
+}
+
+// renderClass holds the queued jobs of a class, per project in arrival order.
+type renderClass struct {
+	config.RenderClass
+	// pass is the virtual time of the class: it advances by 1/Weight on each
+	// dispatch and the class with the lowest pass goes next.
+	pass     float64
+	projects []string
+	queues   map[string][]RenderJob
+	next     int
+}
+
+type renderScheduler struct {
+	config            *config.Config
+	otididae          OtididaeCluster
+	sessionRepository repository.SessionRepository
+
+	mu          sync.Mutex
+	wake        *sync.Cond
+	stopped     bool
+	classes     []*renderClass
+	byName      map[string]*renderClass
+	virtualTime float64
+	running     map[string]int
+	// dispatched holds the sessions being rendered, true once cancelled.
+	dispatched map[string]bool
+}
+
+func NewRenderScheduler(config *config.Config, otididae OtididaeCluster, sessionRepository repository.SessionRepository) RenderScheduler {
+	s := &renderScheduler{
+		config:            config,
+		otididae:          otididae,
+		sessionRepository: sessionRepository,
+		byName:            make(map[string]*renderClass),
+		running:           make(map[string]int),
+		dispatched:        make(map[string]bool),
+	}
+	s.wake = sync.NewCond(&s.mu)
+
+	classes := config.Rendering.Classes
+	if len(classes) == 0 {
+		classes = defaultRenderClasses
+	}
+	for _, class := range classes {
+		if class.Weight <= 0 {
+			class.Weight = 1
+		}
+		c := &renderClass{RenderClass: class, queues: make(map[string][]RenderJob)}
+		s.classes = append(s.classes, c)
+		s.byName[class.Name] = c
+	}
+	return s
+}
+
+func (s *renderScheduler) Priority(key string, requested string) (string, error) {
+	name := s.config.Project(key).RenderPriority
+	if name == "" {
+		name = s.config.Rendering.DefaultClass
+	}
+	if name == "" {
+		name = s.classes[len(s.classes)/2].Name
+	}
+	class, ok := s.byName[name]
+	if !ok {
+		return "", fmt.Errorf("unknown render priority class %q", name)
+	}
+	if requested == "" || requested == name {
+		return name, nil
+	}
+
+	requestedClass, ok := s.byName[requested]
+	if !ok {
+		return "", httpErrors.NewBadRequestError(fmt.Sprintf("unknown priority %q", requested))
+	}
+	if requestedClass.Weight > class.Weight {
+		return "", httpErrors.NewBadRequestError(fmt.Sprintf("priority %q is above the %q class of the project", requested, name))
+	}
+	return requested, nil
+}
+
+func (s *renderScheduler) Enqueue(job RenderJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return fmt.Errorf("render scheduler is stopped")
+	}
+	class, ok := s.byName[job.Priority]
+	if !ok {
+		return fmt.Errorf("unknown render priority class %q", job.Priority)
+	}
+	if class.empty() {
+		// An idle class resumes at the current virtual time instead of
+		// spending the credit it built up while idle.
+		class.pass = max(class.pass, s.virtualTime)
+	}
+	if len(class.queues[job.Key]) == 0 {
+		class.projects = append(class.projects, job.Key)
+	}
+	class.queues[job.Key] = append(class.queues[job.Key], job)
+	s.wake.Signal()
+	return nil
+}
+
+func (s *renderScheduler) Cancel(sessionId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, class := range s.classes {
+		for key, queue := range class.queues {
+			for i, job := range queue {
+				if job.SessionID != sessionId {
+					continue
+				}
+				class.queues[key] = append(queue[:i:i], queue[i+1:]...)
+				if len(class.queues[key]) == 0 {
+					class.removeProject(key)
+				}
+				os.Remove(job.Recording)
+				return true
+			}
+		}
+	}
+	if _, ok := s.dispatched[sessionId]; ok {
+		s.dispatched[sessionId] = true
+	}
+	return false
+}
+
+func (s *renderScheduler) Run(stop <-chan struct{}) {
+	workers := s.config.Rendering.Workers
+	if workers <= 0 {
+		workers = defaultRenderWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				job, ok := s.take()
+				if !ok {
+					return
+				}
+				s.render(job)
+			}
+		}()
+	}
+
+	<-stop
+	s.mu.Lock()
+	s.stopped = true
+	s.wake.Broadcast()
+	s.mu.Unlock()
+	s.failQueued()
+}
+
+func (s *renderScheduler) Status() RenderQueueStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := RenderQueueStatus{Classes: make([]RenderClassStatus, 0, len(s.classes))}
+	for _, class := range s.classes {
+		queued := 0
+		for _, queue := range class.queues {
+			queued += len(queue)
+		}
+		status.Classes = append(status.Classes, RenderClassStatus{Name: class.Name, Weight: class.Weight, Queued: queued})
+	}
+	for _, running := range s.running {
+		status.Running += running
+	}
+	return status
+}
+
+// take waits for the next job to dispatch. It reports false once the
+// scheduler stops.
+func (s *renderScheduler) take() (RenderJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.stopped {
+			return RenderJob{}, false
+		}
+		if job, ok := s.next(); ok {
+			s.running[job.Key]++
+			s.dispatched[job.SessionID] = false
+			return job, true
+		}
+		s.wake.Wait()
+	}
+}
+
+// next pops the job of the class with the lowest pass that has a project
+// under its concurrency cap, taking the projects of the class in turn. The
+// caller holds the lock.
+func (s *renderScheduler) next() (RenderJob, bool) {
+	var selected *renderClass
+	var selectedProject int
+	for _, class := range s.classes {
+		project, ok := class.eligible(s.capped)
+		if !ok {
+			continue
+		}
+		if selected == nil || class.pass < selected.pass || (class.pass == selected.pass && class.Weight > selected.Weight) {
+			selected, selectedProject = class, project
+		}
+	}
+	if selected == nil {
+		return RenderJob{}, false
+	}
+
+	key := selected.projects[selectedProject]
+	job := selected.queues[key][0]
+	selected.queues[key] = selected.queues[key][1:]
+	selected.next = selectedProject + 1
+	if len(selected.queues[key]) == 0 {
+		selected.removeProject(key)
+	}
+
+	s.virtualTime = selected.pass
+	selected.pass += 1 / float64(selected.Weight)
+	return job, true
+}
+
+// capped reports whether the project of key runs as many jobs as it may.
+func (s *renderScheduler) capped(key string) bool {
+	limit := s.config.Project(key).MaxConcurrentRenders
+	return limit > 0 && s.running[key] >= limit
+}
+
+// render runs job on the renderer of its project and marks the session
+// failed when it cannot.
+func (s *renderScheduler) render(job RenderJob) {
+	defer os.Remove(job.Recording)
+
+	renderer, err := newRenderer(s.config.Project(job.Key).Renderer, s.otididae, s.sessionRepository)
+	if err == nil {
+		err = renderer.Render(job)
+	}
+	if err != nil {
+		log.Printf("Failed to generate video: %v", err)
+		if err := s.sessionRepository.CompleteRender(job.SessionID, nil); err != nil {
+			log.Printf("Failed to update session status to error: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.running[job.Key]--
+	if s.running[job.Key] == 0 {
+		delete(s.running, job.Key)
+	}
+	cancelled := s.dispatched[job.SessionID]
+	delete(s.dispatched, job.SessionID)
+	s.wake.Broadcast()
+	s.mu.Unlock()
+
+	if cancelled && renderer != nil {
+		if err := renderer.Delete(job.SessionID); err != nil {
+			log.Printf("Failed to delete video of cancelled render %s: %v", job.SessionID, err)
+		}
+	}
+}
+
+// failQueued marks the sessions still queued at shutdown failed.
+func (s *renderScheduler) failQueued() {
+	s.mu.Lock()
+	var jobs []RenderJob
+	for _, class := range s.classes {
+		for _, queue := range class.queues {
+			jobs = append(jobs, queue...)
+		}
+		class.queues, class.projects = make(map[string][]RenderJob), nil
+	}
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		os.Remove(job.Recording)
+		if err := s.sessionRepository.CompleteRender(job.SessionID, nil); err != nil {
+			log.Printf("Failed to update session status to error: %v", err)
+		}
+	}
+}
+
+func (c *renderClass) empty() bool {
+	return len(c.projects) == 0
+}
+
+// eligible returns the index of the next project in turn that is not capped.
+func (c *renderClass) eligible(capped func(key string) bool) (int, bool) {
+	for i := range c.projects {
+		project := (c.next + i) % len(c.projects)
+		if !capped(c.projects[project]) {
+			return project, true
+		}
+	}
+	return 0, false
+}
+
+func (c *renderClass) removeProject(key string) {
+	delete(c.queues, key)
+	for i, project := range c.projects {
+		if project == key {
+			c.projects = append(c.projects[:i], c.projects[i+1:]...)
+			if c.next > i {
+				c.next--
+			}
+			return
+		}
+	}
+}
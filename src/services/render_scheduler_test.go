@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"nymphicus-service/config"
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestScheduler(projects ...config.ProjectConfig) (*renderScheduler, repository.SessionRepository) {
+	sessions := repository.NewMemorySessionRepository(nil)
+	cfg := &config.Config{
+		Rendering: config.RenderingConfig{
+			DefaultClass: "standard",
+			Classes:      []config.RenderClass{{Name: "interactive", Weight: 8}, {Name: "standard", Weight: 2}, {Name: "bulk", Weight: 1}},
+		},
+		DefaultProject: config.ProjectConfig{Renderer: config.RendererConfig{Backend: RendererNoop}},
+		Projects:       projects,
+	}
+	return NewRenderScheduler(cfg, nil, sessions).(*renderScheduler), sessions
+}
+
+func enqueue(t *testing.T, s *renderScheduler, key string, priority string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := s.Enqueue(RenderJob{Key: key, Priority: priority, SessionID: key + "-" + priority + "-" + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dispatch pops the next job as a worker would, without rendering it.
+func dispatch(s *renderScheduler) (RenderJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.next()
+	if ok {
+		s.running[job.Key]++
+	}
+	return job, ok
+}
+
+func TestPriorityCannotBeRaised(t *testing.T) {
+	s, _ := newTestScheduler(config.ProjectConfig{Key: "vip", RenderPriority: "interactive"})
+
+	for _, test := range []struct {
+		key, requested, want string
+		fails                bool
+	}{
+		{key: "free", want: "standard"},
+		{key: "free", requested: "bulk", want: "bulk"},
+		{key: "free", requested: "interactive", fails: true},
+		{key: "free", requested: "unknown", fails: true},
+		{key: "vip", want: "interactive"},
+		{key: "vip", requested: "standard", want: "standard"},
+	} {
+		got, err := s.Priority(test.key, test.requested)
+		if test.fails != (err != nil) || got != test.want {
+			t.Errorf("Priority(%q, %q) = %q, %v", test.key, test.requested, got, err)
+		}
+	}
+}
+
+func TestClassesShareByWeight(t *testing.T) {
+	s, _ := newTestScheduler()
+	enqueue(t, s, "project", "interactive", 100)
+	enqueue(t, s, "project", "bulk", 100)
+
+	counts := make(map[string]int)
+	for i := 0; i < 90; i++ {
+		job, ok := dispatch(s)
+		if !ok {
+			t.Fatal("queue ran dry")
+		}
+		counts[job.Priority]++
+		s.running = make(map[string]int)
+	}
+	if counts["interactive"] < 79 || counts["interactive"] > 81 {
+		t.Errorf("dispatched %v, want about 80 interactive for 10 bulk", counts)
+	}
+}
+
+func TestProjectConcurrencyCap(t *testing.T) {
+	s, _ := newTestScheduler(config.ProjectConfig{Key: "capped", MaxConcurrentRenders: 1})
+	enqueue(t, s, "capped", "standard", 3)
+	enqueue(t, s, "other", "standard", 1)
+
+	var keys []string
+	for {
+		job, ok := dispatch(s)
+		if !ok {
+			break
+		}
+		keys = append(keys, job.Key)
+	}
+	if len(keys) != 2 || keys[0] != "capped" || keys[1] != "other" {
+		t.Fatalf("dispatched %v, want one job of capped then other", keys)
+	}
+
+	s.running["capped"]--
+	if job, ok := dispatch(s); !ok || job.Key != "capped" {
+		t.Errorf("capped project did not resume once its job returned")
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	s, _ := newTestScheduler()
+	recording := filepath.Join(t.TempDir(), "recording")
+	if err := os.WriteFile(recording, []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Enqueue(RenderJob{Key: "project", Priority: "standard", SessionID: "session", Recording: recording}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Cancel("session") {
+		t.Fatal("queued job was not cancelled")
+	}
+	if _, err := os.Stat(recording); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("recording of the cancelled job was kept: %v", err)
+	}
+	if _, ok := dispatch(s); ok {
+		t.Error("cancelled job was dispatched")
+	}
+	if s.Cancel("session") {
+		t.Error("cancelled a job twice")
+	}
+}
+
+func TestStopFailsQueuedJobs(t *testing.T) {
+	s, sessions := newTestScheduler()
+	session := models.Session{ID: "session", Key: "project", Status: enum.InProgress.String()}
+	if err := sessions.SaveActionsToMongo(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Enqueue(RenderJob{Key: "project", Priority: "standard", SessionID: "session"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.failQueued()
+
+	stored, err := sessions.FindSessionByID("session", "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != enum.Error.String() {
+		t.Errorf("status = %s, want Error", stored.Status)
+	}
+	if err := s.Enqueue(RenderJob{Key: "project", Priority: "standard", SessionID: "late"}); err == nil {
+		t.Error("stopped scheduler accepted a job")
+	}
+}
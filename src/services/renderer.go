@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/config"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+)
+
+const (
+	RendererHTTP = "http"
+	RendererExec = "exec"
+	RendererNoop = "noop"
+)
+
+// RenderJob is the recording of a session, spooled to disk until it is
+// rendered, and what its video is rendered from.
+type RenderJob struct {
+	Key       string
+	Priority  string
+	Recording string
+	Filename  string
+	TimeLines src.ActivityGestureLogs
+	Masks     []models.MaskedSegment
+	SessionID string
+	Duration  string
+}
+
+// Renderer turns recordings into session videos. Render may return before
+// the video exists; the session is completed through
+// SessionRepository.CompleteRender once it does.
+type Renderer interface {
+	Render(job RenderJob) error
+	Delete(sessionId string) error
+}
+
+// newRenderer builds the backend named by rendererConfig.Backend, the
+// Otididae cluster over HTTP by default.
+func newRenderer(rendererConfig config.RendererConfig, otididae OtididaeCluster, sessionRepository repository.SessionRepository) (Renderer, error) {
+	switch rendererConfig.Backend {
+	case "", RendererHTTP:
+		return &httpRenderer{cluster: otididae}, nil
+	case RendererExec:
+		if len(rendererConfig.Command) == 0 || rendererConfig.OutputDir == "" {
+			return nil, fmt.Errorf("the %s renderer needs a Command and an OutputDir", RendererExec)
+		}
+		return &execRenderer{config: rendererConfig, sessionRepository: sessionRepository}, nil
+	case RendererNoop:
+		return noopRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported renderer backend %q", rendererConfig.Backend)
+	}
+}
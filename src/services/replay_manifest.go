@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/src/models"
+	"path"
+)
+
+// ReplayManifestBuilder combines video sources, timeline and device data of
+// a session into one versioned document.
+type ReplayManifestBuilder interface {
+	Build(session models.Session, version int) (models.ReplayManifest, error)
+}
+
+type replayManifestBuilder struct {
+	sessionTimeline SessionTimeline
+}
+
+func NewReplayManifestBuilder(sessionTimeline SessionTimeline) ReplayManifestBuilder {
+	return &replayManifestBuilder{sessionTimeline: sessionTimeline}
+}
+
+func (r *replayManifestBuilder) Build(session models.Session, version int) (models.ReplayManifest, error) {
+	if version != models.ReplayManifestVersion {
+		return models.ReplayManifest{}, httpErrors.NewBadRequestError(fmt.Sprintf("unsupported manifest version %d", version))
+	}
+
+	timeline := r.sessionTimeline.Build(session)
+	manifest := models.ReplayManifest{
+		Version:   models.ReplayManifestVersion,
+		SessionID: session.ID,
+		Status:    session.Status,
+		CreatedAt: session.CreatedAt,
+		Duration:  session.Duration,
+		Sources:   make([]models.MediaSource, 0, 1),
+		Tracks: []models.TextTrack{
+			{URL: fmt.Sprintf("/v2/sessions/%s/timeline.vtt", session.ID), Kind: "captions", Format: "vtt", MimeType: "text/vtt"},
+			{URL: fmt.Sprintf("/v2/sessions/%s/timeline.srt", session.ID), Kind: "captions", Format: "srt", MimeType: "application/x-subrip"},
+		},
+		Chapters: make([]models.Chapter, 0),
+		Timeline: timeline,
+		Signals:  session.Signals,
+		Device:   session.Device,
+	}
+	if manifest.Signals == nil {
+		manifest.Signals = make([]models.FrustrationSignal, 0)
+	}
+
+	if session.VideoUrl != nil && *session.VideoUrl != "" {
+		manifest.Sources = append(manifest.Sources, models.MediaSource{
+			URL:      *session.VideoUrl,
+			MimeType: videoMimeType(*session.VideoUrl),
+		})
+	}
+
+	for _, entry := range timeline {
+		if entry.Kind == models.TimelineActivity {
+			manifest.Chapters = append(manifest.Chapters, models.Chapter{Title: entry.Activity, Start: entry.Start, End: entry.End})
+		}
+	}
+	return manifest, nil
+}
+
+// videoMimeType guesses the type from the URL extension, defaulting to MP4
+// which is what Otididae renders.
+func videoMimeType(videoURL string) string {
+	extension := path.Ext(videoURL)
+	if parsed, err := url.Parse(videoURL); err == nil {
+		extension = path.Ext(parsed.Path)
+	}
+	if mimeType := mime.TypeByExtension(extension); mimeType != "" {
+		return mimeType
+	}
+	return "video/mp4"
+}
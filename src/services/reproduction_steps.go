@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/src/models"
+	"strings"
+)
+
+// ReproductionSteps writes a session as numbered steps ready to paste into a bug ticket.
+type ReproductionSteps interface {
+	Write(session models.Session, format string) (string, error)
+}
+
+type reproductionSteps struct{}
+
+func NewReproductionSteps() ReproductionSteps {
+	return &reproductionSteps{}
+}
+
+// Write renders the steps as "text" or "markdown", each one stamped with its
+// offset from the first recorded action.
+func (r *reproductionSteps) Write(session models.Session, format string) (string, error) {
+	var markdown bool
+	switch format {
+	case "", "text":
+	case "markdown":
+		markdown = true
+	default:
+		return "", httpErrors.NewBadRequestError(fmt.Sprintf("unsupported steps format %q", format))
+	}
+
+	var b strings.Builder
+	if markdown {
+		fmt.Fprintf(&b, "### Environment\n\n")
+		for _, line := range deviceSummary(session) {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+		fmt.Fprintf(&b, "\n### Steps to reproduce\n\n")
+	} else {
+		fmt.Fprintf(&b, "Environment\n")
+		for _, line := range deviceSummary(session) {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+		fmt.Fprintf(&b, "\nSteps to reproduce\n")
+	}
+
+	start, _ := session.Activities.StartTime()
+	step := 0
+	writeStep := func(at int64, text string) {
+		step++
+		if markdown {
+			fmt.Fprintf(&b, "%d. `%s` %s\n", step, formatOffset(at-start), text)
+		} else {
+			fmt.Fprintf(&b, "%d. [%s] %s\n", step, formatOffset(at-start), text)
+		}
+	}
+
+	events := session.Events
+	for i, visit := range session.Activities.Visits() {
+		writeStep(visit.Start, fmt.Sprintf("Open %s", visit.Name))
+		for len(events) > 0 && events[0].ActivityIndex == i {
+			writeStep(events[0].StartTime, describeStep(events[0]))
+			events = events[1:]
+		}
+	}
+	if step == 0 {
+		fmt.Fprintf(&b, "No activity was recorded.\n")
+	}
+	return b.String(), nil
+}
+
+func deviceSummary(session models.Session) []string {
+	device := session.Device
+	lines := []string{
+		fmt.Sprintf("Session: %s", session.ID),
+		fmt.Sprintf("Recorded: %s", session.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC")),
+		fmt.Sprintf("Device: %s %s (%s)", device.Brand, device.Model, device.Device),
+		fmt.Sprintf("OS: %s %s (SDK %d)", device.Platform, device.OsVersion, device.SdkVersion),
+	}
+	if device.AppVersion != "" {
+		lines = append(lines, fmt.Sprintf("App version: %s", device.AppVersion))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Screen: %s", device.ScreenResolution),
+		fmt.Sprintf("Network: %s", device.CurrentNetwork),
+		fmt.Sprintf("Battery: %s", formatBattery(device.BatteryLevel)),
+		fmt.Sprintf("Language: %s", device.Language),
+	)
+	return lines
+}
+
+// formatBattery accepts the level either as a fraction or as a percentage.
+func formatBattery(level float64) string {
+	if level <= 1 {
+		level *= 100
+	}
+	return fmt.Sprintf("%.0f%%", level)
+}
+
+func describeStep(event models.GestureEvent) string {
+	switch event.Type {
+	case enum.Tap.String():
+		return fmt.Sprintf("Tap at (%.0f, %.0f)", event.Start.X, event.Start.Y)
+	case enum.DoubleTap.String():
+		return fmt.Sprintf("Double-tap at (%.0f, %.0f)", event.Start.X, event.Start.Y)
+	case enum.LongPress.String():
+		return fmt.Sprintf("Long-press at (%.0f, %.0f) for %.1fs", event.Start.X, event.Start.Y, float64(event.EndTime-event.StartTime)/1000)
+	case enum.Swipe.String(), enum.Fling.String(), enum.Scroll.String():
+		return fmt.Sprintf("%s %s from (%.0f, %.0f) to (%.0f, %.0f)", capitalize(event.Type), event.Direction,
+			event.Start.X, event.Start.Y, event.End.X, event.End.Y)
+	case enum.Pinch.String():
+		return fmt.Sprintf("Pinch %s at (%.0f, %.0f), scale %.2f", event.Direction, event.Start.X, event.Start.Y, event.Scale)
+	default:
+		return "Unrecognized gesture"
+	}
+}
+
+func capitalize(value string) string {
+	if value == "" {
+		return value
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+// formatOffset writes a millisecond offset as "mm:ss.s".
+func formatOffset(ms int64) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%04.1f", ms/60000, float64(ms%60000)/1000)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"log"
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"strconv"
+	"time"
+)
+
+const retentionReportSample = 20
+
+// RetentionReport lists, per project, the sessions past retention.
+type RetentionReport struct {
+	DryRun   bool                     `json:"dryRun"`
+	Projects []ProjectRetentionReport `json:"projects"`
+}
+
+// ProjectRetentionReport covers one project, or every project without its own
+// settings when Key is empty. Held sessions are past retention but kept.
+type ProjectRetentionReport struct {
+	Key           string    `json:"key"`
+	RetentionDays int       `json:"retentionDays"`
+	CreatedBefore time.Time `json:"createdBefore"`
+	Expired       int       `json:"expired"`
+	Held          int       `json:"held"`
+	Failed        int       `json:"failed"`
+	SessionIDs    []string  `json:"sessionIds"`
+}
+
+// RetentionService expires the sessions older than the retention of their project.
+type RetentionService interface {
+	Sweep(dryRun bool) (RetentionReport, error)
+}
+
+type retentionService struct {
+	config            *config.Config
+	sessionRepository repository.SessionRepository
+	videoService      VideoService
+}
+
+func NewRetentionService(config *config.Config, sessionRepository repository.SessionRepository, videoService VideoService) RetentionService {
+	return &retentionService{
+		config:            config,
+		sessionRepository: sessionRepository,
+		videoService:      videoService,
+	}
+}
+
+// Sweep deletes the rendered video of every session past retention and marks
+// it Expired, skipping sessions on legal hold. With dryRun nothing changes and
+// the report lists what would be purged.
+func (r *retentionService) Sweep(dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Projects: make([]ProjectRetentionReport, 0)}
+	now := time.Now()
+
+	listed := make([]string, 0, len(r.config.Projects))
+	for _, project := range r.config.Projects {
+		listed = append(listed, project.Key)
+		if project.RetentionDays <= 0 {
+			continue
+		}
+		criteria := repository.ExpiryCriteria{Key: project.Key, CreatedBefore: cutoff(now, project.RetentionDays)}
+		projectReport, err := r.sweep(criteria, project.RetentionDays, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Projects = append(report.Projects, projectReport)
+	}
+
+	if days := r.config.DefaultProject.RetentionDays; days > 0 {
+		criteria := repository.ExpiryCriteria{ExcludeKeys: listed, CreatedBefore: cutoff(now, days)}
+		projectReport, err := r.sweep(criteria, days, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Projects = append(report.Projects, projectReport)
+	}
+	return report, nil
+}
+
+func (r *retentionService) sweep(criteria repository.ExpiryCriteria, days int, dryRun bool) (ProjectRetentionReport, error) {
+	report := ProjectRetentionReport{
+		Key:           criteria.Key,
+		RetentionDays: days,
+		CreatedBefore: criteria.CreatedBefore,
+		SessionIDs:    make([]string, 0),
+	}
+
+	err := r.sessionRepository.IterateExpiredSessions(criteria, func(session models.Session) error {
+		if session.LegalHold {
+			report.Held++
+			return nil
+		}
+		if !dryRun {
+			// Only some renderers report the video URL back, so the video is
+			// deleted whether or not the session knows about it.
+			if err := r.videoService.DeleteVideo(session.Key, session.ID); err != nil {
+				log.Printf("Failed to delete video of expired session %s: %v", session.ID, err)
+				report.Failed++
+				return nil
+			}
+			expired, err := r.sessionRepository.ExpireSession(session.ID)
+			if err != nil {
+				return err
+			}
+			if !expired {
+				report.Held++
+				return nil
+			}
+		}
+		report.Expired++
+		if len(report.SessionIDs) < retentionReportSample {
+			report.SessionIDs = append(report.SessionIDs, session.ID)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// Totals sums the expired, held and failed sessions of every project.
+func (r RetentionReport) Totals() (expired, held, failed int) {
+	for _, project := range r.Projects {
+		expired += project.Expired
+		held += project.Held
+		failed += project.Failed
+	}
+	return expired, held, failed
+}
+
+// RetentionAuditDetails summarizes a sweep for the audit log.
+func RetentionAuditDetails(report RetentionReport, err error) map[string]string {
+	expired, held, failed := report.Totals()
+	details := map[string]string{
+		"status":  "done",
+		"expired": strconv.Itoa(expired),
+		"held":    strconv.Itoa(held),
+		"failed":  strconv.Itoa(failed),
+	}
+	if err != nil {
+		details["status"], details["error"] = "failed", err.Error()
+	}
+	return details
+}
+
+func cutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"mime/multipart"
+	"nymphicus-service/config"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"testing"
+	"time"
+)
+
+// deletedVideos is a VideoService recording the videos it is asked to delete.
+type deletedVideos []string
+
+func (d *deletedVideos) RenderPriority(key string, requested string) (string, error) {
+	return requested, nil
+}
+
+func (d *deletedVideos) RequestGenerateVideo(key string, priority string, fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, masks []models.MaskedSegment, sessionId string, duration string) error {
+	return nil
+}
+
+func (d *deletedVideos) DeleteVideo(key string, sessionId string) error {
+	*d = append(*d, sessionId)
+	return nil
+}
+
+func (d *deletedVideos) DeleteOrphanedVideo(sessionId string) error {
+	*d = append(*d, sessionId)
+	return nil
+}
+
+func TestSweepDeletesVideosWithoutURL(t *testing.T) {
+	repo := repository.NewMemorySessionRepository(nil)
+	old := time.Now().AddDate(0, 0, -30)
+	videoURL := "http://videos/rendered.mp4"
+	for _, session := range []models.Session{
+		{ID: "rendered", Key: "key", CreatedAt: old, VideoUrl: &videoURL},
+		{ID: "pending", Key: "key", CreatedAt: old},
+		{ID: "held", Key: "key", CreatedAt: old, LegalHold: true},
+		{ID: "recent", Key: "key", CreatedAt: time.Now()},
+	} {
+		if err := repo.SaveActionsToMongo(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	videos := &deletedVideos{}
+	cfg := &config.Config{DefaultProject: config.ProjectConfig{RetentionDays: 7}}
+	report, err := NewRetentionService(cfg, repo, videos).Sweep(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired, held, _ := report.Totals(); expired != 2 || held != 1 {
+		t.Errorf("expired %d and held %d, want 2 and 1", expired, held)
+	}
+	if len(*videos) != 2 {
+		t.Errorf("deleted videos %v, want those of rendered and pending", *videos)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"sort"
+)
+
+// ScreenFlowBuilder accumulates the activity sequences of many sessions into
+// a navigation graph.
+type ScreenFlowBuilder interface {
+	Add(logs src.ActivityGestureLogs)
+	Build() models.ScreenFlow
+}
+
+type screenStats struct {
+	visits    int
+	entries   int
+	exits     int
+	durations []int64
+}
+
+type screenLinkKey struct {
+	source string
+	target string
+}
+
+type screenFlowBuilder struct {
+	sessions int
+	screens  map[string]*screenStats
+	links    map[screenLinkKey]int
+}
+
+func NewScreenFlowBuilder() ScreenFlowBuilder {
+	return &screenFlowBuilder{
+		screens: make(map[string]*screenStats),
+		links:   make(map[screenLinkKey]int),
+	}
+}
+
+// Add records one session. Consecutive visits of the same activity are merged
+// so that the graph only holds actual navigation.
+func (b *screenFlowBuilder) Add(logs src.ActivityGestureLogs) {
+	visits := mergeRepeatedVisits(logs.Visits())
+	if len(visits) == 0 {
+		return
+	}
+	b.sessions++
+
+	previous := models.ScreenFlowEntry
+	for _, visit := range visits {
+		stats := b.screen(visit.Name)
+		stats.visits++
+		stats.durations = append(stats.durations, visit.Duration())
+		b.links[screenLinkKey{source: previous, target: visit.Name}]++
+		previous = visit.Name
+	}
+	b.links[screenLinkKey{source: previous, target: models.ScreenFlowExit}]++
+
+	b.screen(visits[0].Name).entries++
+	b.screen(visits[len(visits)-1].Name).exits++
+}
+
+func (b *screenFlowBuilder) screen(name string) *screenStats {
+	stats, ok := b.screens[name]
+	if !ok {
+		stats = &screenStats{}
+		b.screens[name] = stats
+	}
+	return stats
+}
+
+// Build returns nodes by visits and links by count, both descending.
+func (b *screenFlowBuilder) Build() models.ScreenFlow {
+	flow := models.ScreenFlow{
+		Sessions: b.sessions,
+		Nodes:    make([]models.ScreenNode, 0, len(b.screens)),
+		Links:    make([]models.ScreenLink, 0, len(b.links)),
+	}
+
+	for name, stats := range b.screens {
+		flow.Nodes = append(flow.Nodes, models.ScreenNode{
+			Name:               name,
+			Visits:             stats.visits,
+			Entries:            stats.entries,
+			Exits:              stats.exits,
+			MedianTimeOnScreen: median(stats.durations),
+		})
+	}
+	sort.Slice(flow.Nodes, func(i, j int) bool {
+		if flow.Nodes[i].Visits != flow.Nodes[j].Visits {
+			return flow.Nodes[i].Visits > flow.Nodes[j].Visits
+		}
+		return flow.Nodes[i].Name < flow.Nodes[j].Name
+	})
+
+	for key, count := range b.links {
+		flow.Links = append(flow.Links, models.ScreenLink{Source: key.source, Target: key.target, Count: count})
+	}
+	sort.Slice(flow.Links, func(i, j int) bool {
+		if flow.Links[i].Count != flow.Links[j].Count {
+			return flow.Links[i].Count > flow.Links[j].Count
+		}
+		if flow.Links[i].Source != flow.Links[j].Source {
+			return flow.Links[i].Source < flow.Links[j].Source
+		}
+		return flow.Links[i].Target < flow.Links[j].Target
+	})
+
+	return flow
+}
+
+func mergeRepeatedVisits(visits []src.ActivityVisit) []src.ActivityVisit {
+	merged := make([]src.ActivityVisit, 0, len(visits))
+	for _, visit := range visits {
+		if n := len(merged); n > 0 && merged[n-1].Name == visit.Name {
+			merged[n-1].End = visit.End
+			continue
+		}
+		merged = append(merged, visit)
+	}
+	return merged
+}
+
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+const sessionStart = 1700000000000
+
+// screen is an activity visited with one tap at each of times, in ms after
+// sessionStart; a screen without times has a single untimed action.
+type screen struct {
+	name  string
+	times []int64
+}
+
+func logsOf(screens ...screen) src.ActivityGestureLogs {
+	var logs src.ActivityGestureLogs
+	for _, s := range screens {
+		activity := src.ActivityGesture{ActivityName: s.name}
+		if len(s.times) == 0 {
+			activity.Gestures = append(activity.Gestures, src.Gesture{Actions: []src.Action{{Action: "KEY_ENTER"}}})
+		}
+		for _, t := range s.times {
+			at := strconv.FormatInt(sessionStart+t, 10)
+			activity.Gestures = append(activity.Gestures, src.Gesture{Actions: []src.Action{
+				{Action: "DOWN", TargetTime: at, Coordinates: "100,100"},
+				{Action: "UP", TargetTime: at, Coordinates: "100,100"},
+			}})
+		}
+		logs.Activities = append(logs.Activities, activity)
+	}
+	return logs
+}
+
+func node(flow models.ScreenFlow, name string) models.ScreenNode {
+	for _, n := range flow.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return models.ScreenNode{}
+}
+
+func TestScreenFlow(t *testing.T) {
+	builder := NewScreenFlowBuilder()
+	builder.Add(logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}}, screen{"Cart", []int64{2000}}, screen{"Pay", []int64{5000}}))
+	builder.Add(logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{3000, 4000}}))
+	flow := builder.Build()
+
+	if flow.Sessions != 2 {
+		t.Errorf("sessions = %d, want 2", flow.Sessions)
+	}
+	cart := node(flow, "Cart")
+	if cart.Visits != 2 || cart.Exits != 1 || cart.MedianTimeOnScreen != 2500 {
+		t.Errorf("Cart = %+v, want 2 visits, 1 exit and a 2500 ms median", cart)
+	}
+	if home := node(flow, "Home"); home.Entries != 2 || home.MedianTimeOnScreen != 2000 {
+		t.Errorf("Home = %+v, want 2 entries and a 2000 ms median", home)
+	}
+	want := models.ScreenLink{Source: "Home", Target: "Cart", Count: 2}
+	if !slices.Contains(flow.Links, want) {
+		t.Errorf("links %+v lack Home -> Cart twice", flow.Links)
+	}
+}
+
+func TestScreenFlowLeadingUntimedScreen(t *testing.T) {
+	builder := NewScreenFlowBuilder()
+	builder.Add(logsOf(screen{name: "Splash"}, screen{"Home", []int64{1000, 4000}}))
+	flow := builder.Build()
+
+	if splash := node(flow, "Splash"); splash.MedianTimeOnScreen != 0 {
+		t.Errorf("untimed Splash spent %d ms on screen, want 0", splash.MedianTimeOnScreen)
+	}
+	if home := node(flow, "Home"); home.MedianTimeOnScreen != 3000 {
+		t.Errorf("Home spent %d ms on screen, want 3000", home.MedianTimeOnScreen)
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/enum"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/src/models"
+	"regexp"
+	"strings"
+)
+
+const (
+	minScriptWait = 100 // ms; shorter gaps are left to the tool's own pacing
+)
+
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// ScriptExporter turns the classified gestures of a session into a runnable test flow.
+type ScriptExporter interface {
+	Export(session models.Session, appID string, format string) (string, error)
+}
+
+// scriptWriter emits the statements of one test tool.
+type scriptWriter interface {
+	header(session models.Session, appID string)
+	activity(name string)
+	wait(ms int64)
+	gesture(event models.GestureEvent)
+	String() string
+}
+
+type scriptExporter struct{}
+
+func NewScriptExporter() ScriptExporter {
+	return &scriptExporter{}
+}
+
+// Export writes session as a maestro, appium-python or adb script. Waits
+// replay the gaps between timed gestures, untimed ones being written without
+// moving the clock, and every activity change is asserted.
+// Without appID the script reads the package from the APP_ID environment variable.
+func (s *scriptExporter) Export(session models.Session, appID string, format string) (string, error) {
+	if appID != "" && !packageNamePattern.MatchString(appID) {
+		return "", httpErrors.NewBadRequestError(fmt.Sprintf("invalid application id %q", appID))
+	}
+
+	var writer scriptWriter
+	switch format {
+	case "maestro":
+		writer = &maestroWriter{}
+	case "appium-python":
+		writer = &appiumPythonWriter{}
+	case "adb":
+		writer = &adbWriter{}
+	default:
+		return "", httpErrors.NewBadRequestError(fmt.Sprintf("unsupported export format %q", format))
+	}
+
+	writer.header(session, appID)
+	activity := -1
+	var previousEnd int64
+	timed := false
+	for _, event := range session.Events {
+		if isTimed(event) {
+			if gap := event.StartTime - previousEnd; timed && gap >= minScriptWait {
+				writer.wait(gap)
+			}
+			previousEnd, timed = event.EndTime, true
+		}
+		if event.ActivityIndex != activity {
+			activity = event.ActivityIndex
+			writer.activity(event.Activity)
+		}
+		writer.gesture(event)
+	}
+	return writer.String(), nil
+}
+
+func gestureDuration(event models.GestureEvent) int64 {
+	return max(event.EndTime-event.StartTime, 1)
+}
+
+// commentText keeps client-supplied text on the comment line it is written to.
+func commentText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// shellQuote quotes s as a single shell word that nothing expands.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type maestroWriter struct {
+	strings.Builder
+}
+
+func (w *maestroWriter) header(session models.Session, appID string) {
+	fmt.Fprintf(w, "# Session %s recorded on %s\n", session.ID, commentText(session.Device.Brand+" "+session.Device.Model))
+	if appID == "" {
+		appID = "${APP_ID}"
+	}
+	fmt.Fprintf(w, "appId: %s\n---\n- launchApp\n", appID)
+}
+
+// activity only documents the expected screen: Maestro cannot assert the
+// foreground activity.
+func (w *maestroWriter) activity(name string) {
+	fmt.Fprintf(w, "# expect %s\n", commentText(name))
+}
+
+// wait writes nothing: Maestro has no plain sleep and already waits for the
+// screen to settle between commands.
+func (w *maestroWriter) wait(ms int64) {}
+
+func (w *maestroWriter) gesture(event models.GestureEvent) {
+	switch event.Type {
+	case enum.Tap.String():
+		fmt.Fprintf(w, "- tapOn:\n    point: \"%.0f,%.0f\"\n", event.Start.X, event.Start.Y)
+	case enum.DoubleTap.String():
+		fmt.Fprintf(w, "- doubleTapOn:\n    point: \"%.0f,%.0f\"\n", event.Start.X, event.Start.Y)
+	case enum.LongPress.String():
+		fmt.Fprintf(w, "- longPressOn:\n    point: \"%.0f,%.0f\"\n", event.Start.X, event.Start.Y)
+	case enum.Swipe.String(), enum.Fling.String(), enum.Scroll.String():
+		fmt.Fprintf(w, "- swipe:\n    start: \"%.0f,%.0f\"\n    end: \"%.0f,%.0f\"\n    duration: %d\n",
+			event.Start.X, event.Start.Y, event.End.X, event.End.Y, gestureDuration(event))
+	default:
+		fmt.Fprintf(w, "# unsupported: %s\n", commentText(event.Description))
+	}
+}
+
+type appiumPythonWriter struct {
+	strings.Builder
+}
+
+func (w *appiumPythonWriter) header(session models.Session, appID string) {
+	fmt.Fprintf(w, "# Session %s recorded on %s\n", session.ID, commentText(fmt.Sprintf("%s %s (Android %s)", session.Device.Brand, session.Device.Model, session.Device.OsVersion)))
+	w.WriteString("import os\nimport time\n\n")
+	w.WriteString("from appium import webdriver\n")
+	w.WriteString("from appium.options.android import UiAutomator2Options\n\n")
+	w.WriteString("options = UiAutomator2Options()\n")
+	if appID == "" {
+		w.WriteString("options.app_package = os.environ[\"APP_ID\"]\n")
+	} else {
+		fmt.Fprintf(w, "options.app_package = %q\n", appID)
+	}
+	w.WriteString("driver = webdriver.Remote(\"http://127.0.0.1:4723\", options=options)\n\n")
+}
+
+func (w *appiumPythonWriter) activity(name string) {
+	fmt.Fprintf(w, "assert driver.current_activity.endswith(%q), driver.current_activity\n", name)
+}
+
+func (w *appiumPythonWriter) wait(ms int64) {
+	fmt.Fprintf(w, "time.sleep(%.3f)\n", float64(ms)/1000)
+}
+
+func (w *appiumPythonWriter) gesture(event models.GestureEvent) {
+	switch event.Type {
+	case enum.Tap.String():
+		fmt.Fprintf(w, "driver.tap([(%.0f, %.0f)])\n", event.Start.X, event.Start.Y)
+	case enum.DoubleTap.String():
+		fmt.Fprintf(w, "driver.tap([(%.0f, %.0f)])\n", event.Start.X, event.Start.Y)
+		fmt.Fprintf(w, "driver.tap([(%.0f, %.0f)])\n", event.End.X, event.End.Y)
+	case enum.LongPress.String():
+		fmt.Fprintf(w, "driver.tap([(%.0f, %.0f)], %d)\n", event.Start.X, event.Start.Y, gestureDuration(event))
+	case enum.Swipe.String(), enum.Fling.String(), enum.Scroll.String():
+		fmt.Fprintf(w, "driver.swipe(%.0f, %.0f, %.0f, %.0f, %d)\n",
+			event.Start.X, event.Start.Y, event.End.X, event.End.Y, gestureDuration(event))
+	default:
+		fmt.Fprintf(w, "# unsupported: %s\n", commentText(event.Description))
+	}
+}
+
+func (w *appiumPythonWriter) String() string {
+	return w.Builder.String() + "\ndriver.quit()\n"
+}
+
+type adbWriter struct {
+	strings.Builder
+}
+
+func (w *adbWriter) header(session models.Session, appID string) {
+	w.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(w, "# Session %s recorded on %s\n", session.ID, commentText(session.Device.Brand+" "+session.Device.Model))
+	w.WriteString("set -e\n\n")
+	if appID == "" {
+		appID = "\"$APP_ID\""
+	}
+	fmt.Fprintf(w, "adb shell monkey -p %s -c android.intent.category.LAUNCHER 1\n", appID)
+}
+
+func (w *adbWriter) activity(name string) {
+	fmt.Fprintf(w, "adb shell dumpsys activity activities | grep mResumedActivity | grep -qF -- %s || { echo %s; exit 1; }\n", shellQuote(name), shellQuote("expected "+name))
+}
+
+func (w *adbWriter) wait(ms int64) {
+	fmt.Fprintf(w, "sleep %.3f\n", float64(ms)/1000)
+}
+
+func (w *adbWriter) gesture(event models.GestureEvent) {
+	switch event.Type {
+	case enum.Tap.String():
+		fmt.Fprintf(w, "adb shell input tap %.0f %.0f\n", event.Start.X, event.Start.Y)
+	case enum.DoubleTap.String():
+		fmt.Fprintf(w, "adb shell input tap %.0f %.0f\n", event.Start.X, event.Start.Y)
+		fmt.Fprintf(w, "adb shell input tap %.0f %.0f\n", event.End.X, event.End.Y)
+	case enum.LongPress.String():
+		fmt.Fprintf(w, "adb shell input swipe %.0f %.0f %.0f %.0f %d\n",
+			event.Start.X, event.Start.Y, event.Start.X, event.Start.Y, gestureDuration(event))
+	case enum.Swipe.String(), enum.Fling.String(), enum.Scroll.String():
+		fmt.Fprintf(w, "adb shell input swipe %.0f %.0f %.0f %.0f %d\n",
+			event.Start.X, event.Start.Y, event.End.X, event.End.Y, gestureDuration(event))
+	default:
+		fmt.Fprintf(w, "# unsupported: %s\n", commentText(event.Description))
+	}
+}
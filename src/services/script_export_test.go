@@ -0,0 +1,92 @@
+package service
+
+import (
+	"nymphicus-service/enum"
+	"nymphicus-service/src/models"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const hostileName = "Main'$(touch pwned)`id`\"\n- launchApp\n"
+
+func hostileSession() models.Session {
+	return models.Session{
+		ID: "session",
+		Events: []models.GestureEvent{
+			{Type: enum.Tap.String(), Activity: hostileName, StartTime: 0, EndTime: 10},
+			{Type: enum.Unknown.String(), Activity: hostileName, StartTime: 500, EndTime: 510, Description: "bad\n- clearState"},
+		},
+	}
+}
+
+func TestShellQuoteIsLiteral(t *testing.T) {
+	for _, value := range []string{"", "plain", "it's", hostileName, `\'\\'`} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(value)).Output()
+		if err != nil {
+			t.Fatalf("sh: %v", err)
+		}
+		if string(out) != value {
+			t.Errorf("shellQuote(%q) came back as %q", value, out)
+		}
+	}
+}
+
+func TestExportKeepsClientTextInert(t *testing.T) {
+	exporter := NewScriptExporter()
+	for _, format := range []string{"maestro", "appium-python", "adb"} {
+		script, err := exporter.Export(hostileSession(), "com.example.app", format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		launches := 0
+		for _, line := range strings.Split(script, "\n") {
+			if line == "- launchApp" {
+				launches++
+			}
+			if strings.HasPrefix(line, "- clearState") {
+				t.Errorf("%s: injected line %q", format, line)
+			}
+		}
+		if format == "maestro" && launches != 1 {
+			t.Errorf("%s: injected command in\n%s", format, script)
+		}
+	}
+}
+
+func TestMaestroDoesNotFakeWaits(t *testing.T) {
+	script, err := NewScriptExporter().Export(hostileSession(), "com.example.app", "maestro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(script, "waitForAnimationToEnd") {
+		t.Errorf("maestro script should not emit timed waits:\n%s", script)
+	}
+}
+
+func TestWaitsSkipUntimedGestures(t *testing.T) {
+	const epoch = 1700000000000
+	session := models.Session{
+		ID: "session",
+		Events: []models.GestureEvent{
+			{Type: enum.Tap.String(), Activity: "Main", StartTime: epoch, EndTime: epoch + 50},
+			{Type: enum.Unknown.String(), Activity: "Main", Description: "KEY_ENTER"},
+			{Type: enum.Tap.String(), Activity: "Main", StartTime: epoch + 2050, EndTime: epoch + 2100},
+		},
+	}
+	for format, want := range map[string]string{"appium-python": "time.sleep(2.000)", "adb": "sleep 2.000"} {
+		script, err := NewScriptExporter().Export(session, "com.example.app", format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		var waits []string
+		for _, line := range strings.Split(script, "\n") {
+			if strings.HasPrefix(line, "sleep ") || strings.HasPrefix(line, "time.sleep(") {
+				waits = append(waits, line)
+			}
+		}
+		if len(waits) != 1 || waits[0] != want {
+			t.Errorf("%s: waits %q, want [%s]", format, waits, want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"nymphicus-service/config"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	bundleVersion        = 1
+	bundleManifestFile   = "manifest.json"
+	videoDownloadLimit   = 512 * 1024 * 1024 // 512 MB
+	videoDownloadTimeout = 2 * time.Minute
+)
+
+// BundleManifest describes the content of a session bundle.
+type BundleManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Sessions  []string  `json:"sessions"`
+}
+
+// RestoredSession maps a bundled session to the one created by Restore.
+type RestoredSession struct {
+	OriginalID string `json:"originalId"`
+	ID         string `json:"id"`
+	Video      bool   `json:"video"`
+}
+
+// SessionArchiver packages sessions into portable tar.gz bundles and imports
+// them back, possibly into another environment.
+type SessionArchiver interface {
+	Archive(w io.Writer, filter repository.SessionFilter, ids []string) (int, error)
+	Restore(r io.Reader, key string) ([]RestoredSession, error)
+}
+
+type sessionArchiver struct {
+	config            *config.Config
+	sessionRepository repository.SessionRepository
+	httpClient        *fasthttp.Client
+}
+
+func NewSessionArchiver(config *config.Config, sessionRepository repository.SessionRepository) SessionArchiver {
+	return &sessionArchiver{
+		config:            config,
+		sessionRepository: sessionRepository,
+		httpClient: &fasthttp.Client{
+			ReadTimeout:        videoDownloadTimeout,
+			StreamResponseBody: true,
+		},
+	}
+}
+
+// Archive writes the sessions in ids, or every session matching filter when
+// ids is empty, as a bundle. Each session gets session.json, the raw gesture
+// logs in activities.json, device.json and its rendered video when it can be
+// downloaded. manifest.json comes last since it lists what was written. The
+// bundle is written as it is built, and videos go through a temporary file,
+// so memory use does not grow with the bundle.
+func (a *sessionArchiver) Archive(w io.Writer, filter repository.SessionFilter, ids []string) (int, error) {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	manifest := BundleManifest{Version: bundleVersion, CreatedAt: time.Now().UTC(), Sessions: make([]string, 0)}
+	add := func(session models.Session) error {
+		if err := a.writeSession(tarWriter, session); err != nil {
+			return err
+		}
+		manifest.Sessions = append(manifest.Sessions, session.ID)
+		return nil
+	}
+
+	if len(ids) > 0 {
+		for _, id := range ids {
+			session, err := a.sessionRepository.FindSessionByID(id, filter.Key)
+			if err != nil {
+				return 0, fmt.Errorf("session %s: %w", id, err)
+			}
+			if err := add(session); err != nil {
+				return 0, err
+			}
+		}
+	} else if err := a.sessionRepository.IterateSessions(filter, add); err != nil {
+		return 0, err
+	}
+
+	if err := writeJSONEntry(tarWriter, bundleManifestFile, manifest); err != nil {
+		return 0, err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return 0, err
+	}
+	return len(manifest.Sessions), gzipWriter.Close()
+}
+
+func (a *sessionArchiver) writeSession(tarWriter *tar.Writer, session models.Session) error {
+	dir := path.Join("sessions", session.ID)
+	if err := writeJSONEntry(tarWriter, path.Join(dir, "session.json"), session); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(tarWriter, path.Join(dir, "activities.json"), session.Activities.Activities); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(tarWriter, path.Join(dir, "device.json"), session.Device); err != nil {
+		return err
+	}
+
+	if session.VideoUrl == nil || *session.VideoUrl == "" {
+		return nil
+	}
+	video, size, err := a.downloadVideo(*session.VideoUrl)
+	if err != nil {
+		// A bundle without the video is still useful to reproduce the session.
+		log.Printf("Skipping video of session %s: %v", session.ID, err)
+		return nil
+	}
+	defer os.Remove(video.Name())
+	defer video.Close()
+	return writeEntryFrom(tarWriter, path.Join(dir, "video"+videoExtension(*session.VideoUrl)), video, size)
+}
+
+// downloadVideo streams the video at videoURL into a temporary file, rewound
+// for reading. The caller removes it.
+func (a *sessionArchiver) downloadVideo(videoURL string) (*os.File, int64, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(videoURL)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	if err := a.httpClient.Do(req, resp); err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status %d", resp.StatusCode())
+	}
+
+	var body io.Reader = bytes.NewReader(resp.Body())
+	if stream := resp.BodyStream(); stream != nil {
+		body = stream
+	}
+	file, err := os.CreateTemp("", "nymphicus-video-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(file, io.LimitReader(body, videoDownloadLimit+1))
+	if err == nil && size > videoDownloadLimit {
+		err = fmt.Errorf("video is larger than %d bytes", videoDownloadLimit)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+// Restore imports every session of a bundle under a new ID into the project
+// of key. Videos are copied to Archive.VideoDir as they are read and served
+// from Archive.VideoBaseURL; without both the restored sessions have no video.
+// The entries of a session must be contiguous, as Archive writes them, and
+// each session is saved once the bundle moves past it, so memory use does not
+// grow with the bundle. A session seen twice makes the bundle invalid. When
+// the restore fails, the sessions already saved are kept and returned.
+func (a *sessionArchiver) Restore(r io.Reader, key string) ([]RestoredSession, error) {
+	if key == "" {
+		return nil, errors.New("key cannot be empty")
+	}
+
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	defer gzipReader.Close()
+
+	restored := make([]RestoredSession, 0)
+	seen := make(map[string]bool)
+	var current restoringSession
+	// A video left to current was not saved with its session.
+	defer func() {
+		if current.video.path != "" {
+			os.Remove(current.video.path)
+		}
+	}()
+	save := func() error {
+		if current.session == nil {
+			return nil
+		}
+		session := current.session
+		session.ID, session.Key, session.VideoUrl = current.id, key, current.video.url
+		if err := a.sessionRepository.SaveActionsToMongo(*session); err != nil {
+			return fmt.Errorf("session %s: %w", current.originalID, err)
+		}
+		restored = append(restored, RestoredSession{OriginalID: current.originalID, ID: session.ID, Video: session.VideoUrl != nil})
+		current.video = storedVideo{}
+		return nil
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return restored, fmt.Errorf("invalid bundle: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		parts := strings.Split(path.Clean(header.Name), "/")
+		if len(parts) != 3 || parts[0] != "sessions" {
+			continue
+		}
+		id, name := parts[1], parts[2]
+		if id != current.originalID {
+			if seen[id] {
+				return restored, fmt.Errorf("invalid bundle: entries of session %s are not contiguous", id)
+			}
+			if err := save(); err != nil {
+				return restored, err
+			}
+			if current.video.path != "" {
+				os.Remove(current.video.path)
+			}
+			seen[id] = true
+			current = restoringSession{originalID: id, id: uuid.New().String()}
+		}
+
+		switch {
+		case name == "session.json":
+			if current.session != nil {
+				return restored, fmt.Errorf("invalid bundle: duplicate session %s", id)
+			}
+			var session models.Session
+			if err := json.NewDecoder(tarReader).Decode(&session); err != nil {
+				return restored, fmt.Errorf("invalid session %s: %v", id, err)
+			}
+			current.session = &session
+		case strings.HasPrefix(name, "video"):
+			if current.video.url != nil {
+				continue
+			}
+			video, err := a.storeVideo(current.id+path.Ext(name), tarReader)
+			if err != nil {
+				return restored, err
+			}
+			current.video = video
+		}
+	}
+	return restored, save()
+}
+
+// restoringSession is the session of a bundle being read by Restore, under
+// its new ID.
+type restoringSession struct {
+	originalID string
+	id         string
+	session    *models.Session
+	video      storedVideo
+}
+
+// storedVideo is a video of a bundle copied to Archive.VideoDir.
+type storedVideo struct {
+	path string
+	url  *string
+}
+
+func (a *sessionArchiver) storeVideo(name string, video io.Reader) (storedVideo, error) {
+	dir, baseURL := a.config.Archive.VideoDir, a.config.Archive.VideoBaseURL
+	if dir == "" || baseURL == "" {
+		return storedVideo{}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return storedVideo{}, err
+	}
+	videoPath := filepath.Join(dir, name)
+	file, err := os.OpenFile(videoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return storedVideo{}, err
+	}
+	_, err = io.Copy(file, video)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(videoPath)
+		return storedVideo{}, err
+	}
+	videoURL := strings.TrimSuffix(baseURL, "/") + "/" + name
+	return storedVideo{path: videoPath, url: &videoURL}, nil
+}
+
+func writeJSONEntry(tarWriter *tar.Writer, name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeEntry(tarWriter, name, data)
+}
+
+func writeEntry(tarWriter *tar.Writer, name string, data []byte) error {
+	return writeEntryFrom(tarWriter, name, bytes.NewReader(data), int64(len(data)))
+}
+
+func writeEntryFrom(tarWriter *tar.Writer, name string, r io.Reader, size int64) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tarWriter, r, size)
+	return err
+}
+
+func videoExtension(videoURL string) string {
+	if extension := path.Ext(strings.SplitN(videoURL, "?", 2)[0]); extension != "" && len(extension) <= 5 {
+		return extension
+	}
+	return ".mp4"
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"nymphicus-service/config"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bundleEntry is a file of a hand-made bundle.
+type bundleEntry struct {
+	name, content string
+}
+
+func bundleOf(t *testing.T, entries ...bundleEntry) *bytes.Buffer {
+	t.Helper()
+	bundle := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(bundle)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		if err := writeEntry(tarWriter, entry.name, []byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func newTestArchiver(t *testing.T) (SessionArchiver, repository.SessionRepository, string) {
+	repo := repository.NewMemorySessionRepository(nil)
+	videoDir := t.TempDir()
+	cfg := &config.Config{Archive: config.ArchiveConfig{VideoDir: videoDir, VideoBaseURL: "http://videos/"}}
+	return NewSessionArchiver(cfg, repo), repo, videoDir
+}
+
+func TestArchiveRestoreRoundTrip(t *testing.T) {
+	archiver, repo, _ := newTestArchiver(t)
+	originals := []models.Session{
+		{ID: "first", Key: "key", Device: models.Device{InstallID: "install"}, Activities: logsOf(screen{"Home", []int64{0}}, screen{"Cart", []int64{1000}})},
+		{ID: "second", Key: "key", Activities: src.ActivityGestureLogs{Activities: []src.ActivityGesture{{ActivityName: "Login"}}}},
+	}
+	for _, session := range originals {
+		if err := repo.SaveActionsToMongo(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle := &bytes.Buffer{}
+	if archived, err := archiver.Archive(bundle, repository.SessionFilter{Key: "key"}, []string{"first", "second"}); err != nil || archived != 2 {
+		t.Fatalf("archived %d sessions: %v", archived, err)
+	}
+	restored, err := archiver.Restore(bundle, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("restored %+v, want both sessions", restored)
+	}
+	for i, original := range originals {
+		if restored[i].OriginalID != original.ID || restored[i].ID == original.ID || restored[i].Video {
+			t.Errorf("restored %+v from %s", restored[i], original.ID)
+		}
+		session, err := repo.FindSessionByID(restored[i].ID, "other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(session.Activities, original.Activities) || session.Device != original.Device {
+			t.Errorf("session %s came back as %+v", original.ID, session)
+		}
+	}
+}
+
+func TestRestoreStoresVideos(t *testing.T) {
+	archiver, repo, videoDir := newTestArchiver(t)
+	restored, err := archiver.Restore(bundleOf(t,
+		bundleEntry{"sessions/a/session.json", `{"id":"a"}`},
+		bundleEntry{"sessions/a/video.mp4", "video"},
+	), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || !restored[0].Video {
+		t.Fatalf("restored %+v, want a with its video", restored)
+	}
+	session, err := repo.FindSessionByID(restored[0].ID, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.VideoUrl == nil || *session.VideoUrl != "http://videos/"+restored[0].ID+".mp4" {
+		t.Errorf("video URL %v", session.VideoUrl)
+	}
+	if video, err := os.ReadFile(filepath.Join(videoDir, restored[0].ID+".mp4")); err != nil || string(video) != "video" {
+		t.Errorf("stored video %q: %v", video, err)
+	}
+}
+
+func TestRestoreRejectsRepeatedSessions(t *testing.T) {
+	for name, test := range map[string]struct {
+		entries []bundleEntry
+		error   string
+		saved   int
+	}{
+		"duplicate session.json": {
+			entries: []bundleEntry{
+				{"sessions/a/session.json", `{"id":"a"}`},
+				{"sessions/a/video.mp4", "video"},
+				{"sessions/a/session.json", `{"id":"a"}`},
+			},
+			error: "duplicate session a",
+		},
+		"entries split": {
+			entries: []bundleEntry{
+				{"sessions/a/session.json", `{"id":"a"}`},
+				{"sessions/b/session.json", `{"id":"b"}`},
+				{"sessions/b/video.mp4", "video"},
+				{"sessions/a/session.json", `{"id":"a"}`},
+			},
+			error: "entries of session a are not contiguous",
+			saved: 1,
+		},
+	} {
+		archiver, _, videoDir := newTestArchiver(t)
+		restored, err := archiver.Restore(bundleOf(t, test.entries...), "key")
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: error %v, want %q", name, err, test.error)
+		}
+		if len(restored) != test.saved {
+			t.Errorf("%s: restored %+v, want %d sessions", name, restored, test.saved)
+		}
+		if videos, _ := os.ReadDir(videoDir); len(videos) != 0 {
+			t.Errorf("%s: left %d videos of sessions not saved", name, len(videos))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"nymphicus-service/pkg/httpErrors"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"strconv"
+	"time"
+)
+
+// SessionExporter streams the sessions matching a filter for bulk loads.
+type SessionExporter interface {
+	Export(w io.Writer, filter repository.SessionFilter, format string) error
+}
+
+type sessionExporter struct {
+	sessionRepository repository.SessionRepository
+}
+
+func NewSessionExporter(sessionRepository repository.SessionRepository) SessionExporter {
+	return &sessionExporter{sessionRepository: sessionRepository}
+}
+
+// exportedSession is one NDJSON line: the session plus the token that resumes
+// the export right after it.
+type exportedSession struct {
+	models.Session
+	ResumeToken string `json:"resumeToken"`
+}
+
+var csvHeader = []string{
+	"session_id", "key", "created_at", "status", "duration",
+	"platform", "os_version", "brand", "model", "app_version", "install_id",
+	"activity_index", "activity_name", "gesture_index", "action_index",
+	"action", "target_time", "coordinates", "resume_token",
+}
+
+// ValidateExportFormat reports whether format is supported by Export.
+func ValidateExportFormat(format string) error {
+	if format != "ndjson" && format != "csv" {
+		return httpErrors.NewBadRequestError(fmt.Sprintf("unsupported export format %q", format))
+	}
+	return nil
+}
+
+// Export writes the sessions as "ndjson", one session per line, or as "csv",
+// one row per action. Every record carries a resume token to pass back as
+// filter.After when the export is interrupted.
+func (e *sessionExporter) Export(w io.Writer, filter repository.SessionFilter, format string) error {
+	if err := ValidateExportFormat(format); err != nil {
+		return err
+	}
+
+	if format == "ndjson" {
+		encoder := json.NewEncoder(w)
+		return e.sessionRepository.IterateSessions(filter, func(session models.Session) error {
+			return encoder.Encode(exportedSession{Session: session, ResumeToken: resumeToken(session)})
+		})
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	err := e.sessionRepository.IterateSessions(filter, func(session models.Session) error {
+		for _, row := range flattenSession(session) {
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func resumeToken(session models.Session) string {
+	return repository.SessionCursor{CreatedAt: session.CreatedAt, ID: session.ID}.Encode()
+}
+
+// flattenSession returns one CSV row per action, or a single row without
+// action columns for a session that recorded none.
+func flattenSession(session models.Session) [][]string {
+	device := session.Device
+	base := []string{
+		session.ID, session.Key, session.CreatedAt.UTC().Format(time.RFC3339Nano), session.Status,
+		strconv.FormatInt(session.Duration, 10),
+		device.Platform, device.OsVersion, device.Brand, device.Model, device.AppVersion, device.InstallID,
+	}
+	token := resumeToken(session)
+
+	var rows [][]string
+	for activityIndex, activity := range session.Activities.Activities {
+		for gestureIndex, gesture := range activity.Gestures {
+			for actionIndex, action := range gesture.Actions {
+				row := append(append([]string(nil), base...),
+					strconv.Itoa(activityIndex), activity.ActivityName,
+					strconv.Itoa(gestureIndex), strconv.Itoa(actionIndex),
+					action.Action, action.TargetTime, action.Coordinates, token)
+				rows = append(rows, row)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, append(append([]string(nil), base...), "", "", "", "", "", "", "", token))
+	}
+	return rows
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"nymphicus-service/src"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"testing"
+	"time"
+)
+
+func exportedSessions(t *testing.T) repository.SessionRepository {
+	t.Helper()
+	sessions := repository.NewMemorySessionRepository(nil)
+	createdAt := time.UnixMilli(1700000000000).UTC()
+	for _, session := range []models.Session{
+		{
+			ID: "first", Key: "key", CreatedAt: createdAt, Status: "Complete", Duration: 3000,
+			Device: models.Device{Platform: "android", Brand: "Acme", Model: "One", InstallID: "install"},
+			Activities: src.ActivityGestureLogs{Activities: []src.ActivityGesture{
+				{ActivityName: "Main", Gestures: []src.Gesture{{Actions: []src.Action{
+					{Action: "DOWN", TargetTime: "10", Coordinates: "1,2"},
+					{Action: "UP", TargetTime: "20", Coordinates: "1,2"},
+				}}}},
+				{ActivityName: "Empty"},
+			}},
+		},
+		{ID: "second", Key: "key", CreatedAt: createdAt.Add(time.Second), Status: "InProgress"},
+	} {
+		if err := sessions.SaveActionsToMongo(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sessions
+}
+
+func TestExportCSVFlattensActions(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewSessionExporter(exportedSessions(t)).Export(&out, repository.SessionFilter{Key: "key"}, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want the header, two actions and an empty session", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != len(csvHeader) {
+			t.Fatalf("row %q has %d columns, want %d", row, len(row), len(csvHeader))
+		}
+	}
+
+	column := func(row []string, name string) string {
+		for i, header := range csvHeader {
+			if header == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	up := rows[2]
+	if column(up, "session_id") != "first" || column(up, "action") != "UP" || column(up, "action_index") != "1" || column(up, "brand") != "Acme" {
+		t.Errorf("second action row = %q", up)
+	}
+	empty := rows[3]
+	if column(empty, "session_id") != "second" || column(empty, "action") != "" || column(empty, "activity_name") != "" {
+		t.Errorf("session without actions = %q", empty)
+	}
+
+	cursor, err := repository.DecodeSessionCursor(column(up, "resume_token"))
+	if err != nil || cursor.ID != "first" {
+		t.Fatalf("resume token of the first session decodes to %+v, %v", cursor, err)
+	}
+	var resumed bytes.Buffer
+	if err := NewSessionExporter(exportedSessions(t)).Export(&resumed, repository.SessionFilter{Key: "key", After: &cursor}, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := csv.NewReader(&resumed).ReadAll(); len(rows) != 2 || rows[1][0] != "second" {
+		t.Errorf("resumed export = %q, want only the second session", rows)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"nymphicus-service/src/models"
+	"strings"
+)
+
+const minCueDuration = 1000 // ms a gesture cue stays on screen
+
+// SessionTimeline places the activities and gestures of a session on the
+// video timeline and writes them as subtitle tracks.
+type SessionTimeline interface {
+	Build(session models.Session) []models.TimelineEntry
+	WriteWebVTT(entries []models.TimelineEntry) string
+	WriteSRT(entries []models.TimelineEntry) string
+}
+
+type sessionTimeline struct{}
+
+func NewSessionTimeline() SessionTimeline {
+	return &sessionTimeline{}
+}
+
+// Build returns one entry per activity visit followed by its gestures, in
+// milliseconds from the recording start. Session.Duration, in milliseconds,
+// caps the end of every entry that starts within the video and extends the
+// last activity to the end of the video.
+func (t *sessionTimeline) Build(session models.Session) []models.TimelineEntry {
+	origin := session.Activities.Origin()
+	clamp := func(entry models.TimelineEntry) models.TimelineEntry {
+		entry.Start -= origin
+		entry.End -= origin
+		if session.Duration > 0 && entry.Start < session.Duration && entry.End > session.Duration {
+			entry.End = session.Duration
+		}
+		return entry
+	}
+
+	entries := make([]models.TimelineEntry, 0)
+	events := session.Events
+	visits := session.Activities.Visits()
+	for i, visit := range visits {
+		// The last activity stays on screen until the video ends.
+		if i == len(visits)-1 && session.Duration+origin > visit.End {
+			visit.End = session.Duration + origin
+		}
+		entries = append(entries, clamp(models.TimelineEntry{
+			Kind:     models.TimelineActivity,
+			Start:    visit.Start,
+			End:      visit.End,
+			Activity: visit.Name,
+			Label:    fmt.Sprintf("Open %s", visit.Name),
+		}))
+		for len(events) > 0 && events[0].ActivityIndex == i {
+			event := events[0]
+			position := event.Start
+			entries = append(entries, clamp(models.TimelineEntry{
+				Kind:     models.TimelineGesture,
+				Start:    event.StartTime,
+				End:      max(event.EndTime, event.StartTime+minCueDuration),
+				Activity: event.Activity,
+				Gesture:  event.Type,
+				Position: &position,
+				Label:    capitalize(event.Description),
+			}))
+			events = events[1:]
+		}
+	}
+	return entries
+}
+
+func (t *sessionTimeline) WriteWebVTT(entries []models.TimelineEntry) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, entry := range entries {
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1, cueTimestamp(entry.Start, "."), cueTimestamp(entry.End, "."), webVTTText(entry.Label))
+	}
+	return b.String()
+}
+
+func (t *sessionTimeline) WriteSRT(entries []models.TimelineEntry) string {
+	var b strings.Builder
+	for i, entry := range entries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n", i+1, cueTimestamp(entry.Start, ","), cueTimestamp(entry.End, ","), srtText(entry.Label))
+	}
+	return b.String()
+}
+
+// cueTimestamp writes milliseconds as "hh:mm:ss.mmm", with the fraction
+// separator WebVTT (".") and SRT (",") disagree on.
+func cueTimestamp(ms int64, separator string) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+var webVTTEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// webVTTText makes a label safe as the text of a WebVTT cue, where markup
+// starts with "<" and "&".
+func webVTTText(label string) string {
+	return webVTTEscaper.Replace(cueLine(label))
+}
+
+// srtText makes a label safe as the text of an SRT cue, which has no escaping:
+// an arrow is broken up so that it cannot pass for a timing line.
+func srtText(label string) string {
+	label = cueLine(label)
+	for strings.Contains(label, "-->") {
+		label = strings.ReplaceAll(label, "-->", "->")
+	}
+	return label
+}
+
+// cueLine keeps a label on one line, as a line break, or a blank line, would
+// end the cue or start a new one.
+func cueLine(label string) string {
+	return strings.Join(strings.Fields(label), " ")
+}
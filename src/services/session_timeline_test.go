@@ -0,0 +1,45 @@
+package service
+
+import (
+	"nymphicus-service/src/models"
+	"strings"
+	"testing"
+)
+
+const hostileLabel = "Tap <b>Pay</b> & go\n\n00:00:09.000 --> 00:00:10.000\r\nInjected --->"
+
+func hostileEntries() []models.TimelineEntry {
+	return []models.TimelineEntry{
+		{Kind: models.TimelineGesture, Start: 0, End: 1000, Label: hostileLabel},
+		{Kind: models.TimelineGesture, Start: 1000, End: 2000, Label: "Swipe left"},
+	}
+}
+
+// cueCount counts the timing lines of a subtitle track.
+func cueCount(track string) int {
+	return strings.Count(track, "-->")
+}
+
+func TestWebVTTEscapesLabels(t *testing.T) {
+	track := NewSessionTimeline().WriteWebVTT(hostileEntries())
+	if cueCount(track) != 2 {
+		t.Fatalf("want 2 cues, got:\n%s", track)
+	}
+	want := "Tap &lt;b&gt;Pay&lt;/b&gt; &amp; go 00:00:09.000 --&gt; 00:00:10.000 Injected ---&gt;\n"
+	if !strings.Contains(track, "\n"+want) {
+		t.Errorf("label not escaped on one line:\n%s", track)
+	}
+}
+
+func TestSRTKeepsLabelsOnOneLine(t *testing.T) {
+	track := NewSessionTimeline().WriteSRT(hostileEntries())
+	if cueCount(track) != 2 {
+		t.Fatalf("want 2 cues, got:\n%s", track)
+	}
+	if !strings.Contains(track, "\nTap <b>Pay</b> & go 00:00:09.000 -> 00:00:10.000 Injected ->\n") {
+		t.Errorf("label not on one line:\n%s", track)
+	}
+	if !strings.Contains(track, "\nSwipe left\n") {
+		t.Errorf("plain label changed:\n%s", track)
+	}
+}
@@ -1,34 +1,51 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"io"
-	"log"
 	"mime/multipart"
 	"nymphicus-service/config"
 	"nymphicus-service/src"
-	"path/filepath"
-
-	"github.com/valyala/fasthttp"
+	"nymphicus-service/src/models"
+	"nymphicus-service/src/repository"
+	"os"
 )
 
 type VideoService interface {
-	RequestGenerateVideo(fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, sessionId string, duration string) error
+	RenderPriority(key string, requested string) (string, error)
+	RequestGenerateVideo(key string, priority string, fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, masks []models.MaskedSegment, sessionId string, duration string) error
+	DeleteVideo(key string, sessionId string) error
+	DeleteOrphanedVideo(sessionId string) error
 }
 
 type videoService struct {
-	config *config.Config
+	config            *config.Config
+	otididae          OtididaeCluster
+	scheduler         RenderScheduler
+	sessionRepository repository.SessionRepository
 }
 
-func NewVideoService(config *config.Config) VideoService {
+// NewVideoService queues renders on scheduler, which hands them to the
+// Renderer backend of their project, the http one through otididae.
+func NewVideoService(config *config.Config, otididae OtididaeCluster, scheduler RenderScheduler, sessionRepository repository.SessionRepository) VideoService {
 	return &videoService{
-		config: config,
+		config:            config,
+		otididae:          otididae,
+		scheduler:         scheduler,
+		sessionRepository: sessionRepository,
 	}
 }
 
-func (v *videoService) RequestGenerateVideo(fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, sessionId string, duration string) error {
+// RenderPriority returns the priority class of a render of the project of
+// key, requested by the client or the one of the project when empty.
+func (v *videoService) RenderPriority(key string, requested string) (string, error) {
+	return v.scheduler.Priority(key, requested)
+}
+
+// RequestGenerateVideo spools the recording of a session of the project of
+// key and queues it for rendering with priority. masks lists the video
+// segments of masked activities for the renderer to blur.
+func (v *videoService) RequestGenerateVideo(key string, priority string, fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, masks []models.MaskedSegment, sessionId string, duration string) error {
 	if fileHeader == nil {
 		return errors.New("fileHeader cannot be nil")
 	}
@@ -39,80 +56,70 @@ func (v *videoService) RequestGenerateVideo(fileHeader *multipart.FileHeader, ti
 		return errors.New("duration cannot be empty")
 	}
 
-	body, contentType, err := createRequestBody(fileHeader, timeLines, sessionId, duration)
+	recording, err := v.spool(fileHeader, sessionId)
 	if err != nil {
 		return err
 	}
-
-	req := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(req)
-	req.Header.SetMethod("POST")
-	req.Header.SetContentType(contentType)
-
-	if v.config.Services.OtididaeURL == "" {
-		return errors.New("OtididaeURL cannot be empty")
+	err = v.scheduler.Enqueue(RenderJob{
+		Key:       key,
+		Priority:  priority,
+		Recording: recording,
+		Filename:  fileHeader.Filename,
+		TimeLines: timeLines,
+		Masks:     masks,
+		SessionID: sessionId,
+		Duration:  duration,
+	})
+	if err != nil {
+		os.Remove(recording)
 	}
+	return err
+}
 
-	req.SetRequestURI(v.config.Services.OtididaeURL)
-	req.SetBody(body.Bytes())
-
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
-	if err := fasthttp.Do(req, resp); err != nil {
+// DeleteVideo cancels the render of a session of the project of key and
+// deletes its video. A session the renderer does not know about counts as
+// deleted.
+func (v *videoService) DeleteVideo(key string, sessionId string) error {
+	if sessionId == "" {
+		return errors.New("sessionId cannot be empty")
+	}
+	if v.scheduler.Cancel(sessionId) {
+		return nil
+	}
+	renderer, err := newRenderer(v.config.Project(key).Renderer, v.otididae, v.sessionRepository)
+	if err != nil {
 		return err
 	}
-
-	log.Printf("Response status code: %d\n", resp.StatusCode())
-	log.Printf("Response body: %s\n", resp.Body())
-
-	return nil
+	return renderer.Delete(sessionId)
 }
 
-func createRequestBody(fileHeader *multipart.FileHeader, timeLines src.ActivityGestureLogs, sessionId string, duration string) (*bytes.Buffer, string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// DeleteOrphanedVideo deletes the video Otididae reports for a session that
+// no longer exists. The project of the session went with it, but only the
+// http renderer reports videos, so Otididae is the one holding it.
+func (v *videoService) DeleteOrphanedVideo(sessionId string) error {
+	if sessionId == "" {
+		return errors.New("sessionId cannot be empty")
+	}
+	return (&httpRenderer{cluster: v.otididae}).Delete(sessionId)
+}
 
+// spool copies the uploaded recording to Rendering.SpoolDir, as the request
+// it came with is gone by the time it is rendered.
+func (v *videoService) spool(fileHeader *multipart.FileHeader, sessionId string) (string, error) {
 	file, err := fileHeader.Open()
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
-	defer func(file multipart.File) {
-		if err := file.Close(); err != nil {
-			log.Printf("Error closing file: %v", err)
-		}
-	}(file)
+	defer file.Close()
 
-	part, err := writer.CreateFormFile("file", filepath.Base(fileHeader.Filename))
+	spooled, err := os.CreateTemp(v.config.Rendering.SpoolDir, "render-"+sessionId+"-*")
 	if err != nil {
-		return nil, "", err
-	}
-	if _, err = io.Copy(part, file); err != nil {
-		return nil, "", err
-	}
-
-	if err = addFormField(writer, "timeLines", timeLines); err != nil {
-		return nil, "", err
-	}
-
-	if err = writer.WriteField("sessionId", sessionId); err != nil {
-		return nil, "", err
-	}
-
-	if err = writer.WriteField("duration", duration); err != nil {
-		return nil, "", err
-	}
-
-	if err = writer.Close(); err != nil {
-		return nil, "", err
+		return "", err
 	}
-
-	return body, writer.FormDataContentType(), nil
-}
-
-func addFormField(writer *multipart.Writer, fieldName string, value interface{}) error {
-	jsonData, err := json.Marshal(value)
-	if err != nil {
-		return err
+	if _, err := io.Copy(spooled, file); err != nil {
+		spooled.Close()
+		os.Remove(spooled.Name())
+		return "", err
 	}
-	return writer.WriteField(fieldName, string(jsonData))
+	return spooled.Name(), spooled.Close()
 }
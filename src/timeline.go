@@ -0,0 +1,98 @@
+package src
+
+import "slices"
+
+// ActivityVisit is one entry of the activity sequence with its time span in
+// milliseconds, as reported by the TargetTime of its actions.
+type ActivityVisit struct {
+	Name  string
+	Start int64
+	End   int64
+}
+
+// Duration returns the time spent on the visit in milliseconds.
+func (v ActivityVisit) Duration() int64 {
+	return v.End - v.Start
+}
+
+// Visits returns the activities in order with their time spans. A visit ends
+// when the next one starts; the last one ends with its last action. Visits
+// without any timed action inherit the end of the previous visit, or take no
+// time at the start of the first timed visit when they lead the sequence.
+func (l ActivityGestureLogs) Visits() []ActivityVisit {
+	visits := make([]ActivityVisit, len(l.Activities))
+	timed := make([]bool, len(l.Activities))
+	for i, activity := range l.Activities {
+		visits[i].Name = activity.ActivityName
+		for _, gesture := range activity.Gestures {
+			for _, action := range gesture.Actions {
+				t, err := action.Timestamp()
+				if err != nil {
+					continue
+				}
+				if !timed[i] || t < visits[i].Start {
+					visits[i].Start = t
+				}
+				if !timed[i] || t > visits[i].End {
+					visits[i].End = t
+				}
+				timed[i] = true
+			}
+		}
+	}
+
+	first := slices.Index(timed, true)
+	for i := range visits {
+		switch {
+		case timed[i]:
+		case i < first:
+			visits[i].Start = visits[first].Start
+			visits[i].End = visits[first].Start
+		case i > 0:
+			visits[i].Start = visits[i-1].End
+			visits[i].End = visits[i-1].End
+		}
+	}
+	for i := 0; i+1 < len(visits); i++ {
+		if timed[i+1] && visits[i+1].Start > visits[i].End {
+			visits[i].End = visits[i+1].Start
+		}
+	}
+	return visits
+}
+
+// StartTime returns the earliest TargetTime of the logs in milliseconds.
+func (l ActivityGestureLogs) StartTime() (int64, bool) {
+	var start int64
+	found := false
+	for _, activity := range l.Activities {
+		for _, gesture := range activity.Gestures {
+			for _, action := range gesture.Actions {
+				t, err := action.Timestamp()
+				if err != nil {
+					continue
+				}
+				if !found || t < start {
+					start = t
+					found = true
+				}
+			}
+		}
+	}
+	return start, found
+}
+
+// epochThreshold separates relative TargetTimes from Unix timestamps in
+// milliseconds; 1e11 ms is early 1973.
+const epochThreshold = 1e11
+
+// Origin returns the TargetTime that corresponds to the start of the
+// recording. Relative TargetTimes already count from the recording start;
+// Unix timestamps are anchored at the earliest action.
+func (l ActivityGestureLogs) Origin() int64 {
+	start, ok := l.StartTime()
+	if !ok || start < epochThreshold {
+		return 0
+	}
+	return start
+}
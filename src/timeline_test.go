@@ -0,0 +1,68 @@
+package src
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// activity builds an activity whose actions happen at times, empty strings
+// standing for actions without a parseable TargetTime.
+func activity(name string, times ...string) ActivityGesture {
+	gesture := Gesture{}
+	for _, t := range times {
+		gesture.Actions = append(gesture.Actions, Action{Action: "DOWN", TargetTime: t, Coordinates: "1,1"})
+	}
+	return ActivityGesture{ActivityName: name, Gestures: []Gesture{gesture}}
+}
+
+func epoch(offset int64) string {
+	return strconv.FormatInt(1700000000000+offset, 10)
+}
+
+func TestVisits(t *testing.T) {
+	const base = 1700000000000
+	for _, test := range []struct {
+		name string
+		logs []ActivityGesture
+		want []ActivityVisit
+	}{
+		{
+			name: "timed",
+			logs: []ActivityGesture{activity("A", epoch(0), epoch(500)), activity("B", epoch(2000), epoch(2500))},
+			want: []ActivityVisit{{"A", base, base + 2000}, {"B", base + 2000, base + 2500}},
+		},
+		{
+			name: "untimed in the middle",
+			logs: []ActivityGesture{activity("A", epoch(0), epoch(500)), activity("B", ""), activity("C", epoch(3000))},
+			want: []ActivityVisit{{"A", base, base + 500}, {"B", base + 500, base + 3000}, {"C", base + 3000, base + 3000}},
+		},
+		{
+			name: "untimed first",
+			logs: []ActivityGesture{activity("A", ""), activity("B"), activity("C", epoch(1000), epoch(1500))},
+			want: []ActivityVisit{{"A", base + 1000, base + 1000}, {"B", base + 1000, base + 1000}, {"C", base + 1000, base + 1500}},
+		},
+		{
+			name: "nothing timed",
+			logs: []ActivityGesture{activity("A", ""), activity("B")},
+			want: []ActivityVisit{{"A", 0, 0}, {"B", 0, 0}},
+		},
+		{
+			name: "relative times",
+			logs: []ActivityGesture{activity("A", "0", "100"), activity("B", "400")},
+			want: []ActivityVisit{{"A", 0, 400}, {"B", 400, 400}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			visits := ActivityGestureLogs{Activities: test.logs}.Visits()
+			if !reflect.DeepEqual(visits, test.want) {
+				t.Errorf("got %v, want %v", visits, test.want)
+			}
+			for _, visit := range visits {
+				if visit.Duration() < 0 || visit.Duration() > 1e6 {
+					t.Errorf("visit %s lasts %d ms", visit.Name, visit.Duration())
+				}
+			}
+		})
+	}
+}